@@ -0,0 +1,8 @@
+package main
+
+import "embed"
+
+// embeddedAssets 编译进二进制的模板和静态资源，程序可以在任意目录启动
+//
+//go:embed templates static
+var embeddedAssets embed.FS
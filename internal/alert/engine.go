@@ -0,0 +1,276 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/storage"
+	"heart-rate-server/internal/utils"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+const (
+	// ruleCacheTTL 规则在本实例缓存的时间，其它实例上的修改和状态变化最多在此时间后生效
+	ruleCacheTTL = 5 * time.Second
+	// noDataInterval 检查未上报规则的间隔
+	noDataInterval = 15 * time.Second
+	// lastSeenTTL 最后上报时间的保留时长，不短于未上报规则的最大时长
+	lastSeenTTL = 25 * time.Hour
+)
+
+type ruleEntry struct {
+	rules     []models.AlertRule
+	expiresAt time.Time
+}
+
+// Engine 在上报时检查用户的告警规则，并定时检查未上报规则。
+// 规则状态的变化以条件更新写入数据库，多个实例同时检查时只有一个会记录告警
+type Engine struct {
+	DB    *gorm.DB
+	Redis redis.UniversalClient
+	Store *storage.HeartRateStore
+	// Gap 相邻样本间隔超过该时间时认为数据中断，持续条件不成立
+	Gap time.Duration
+	// OnEvent 记录告警后调用，用于发送通知
+	OnEvent func(ctx context.Context, event models.AlertEvent)
+	// Prefer 从按时间排序的样本中筛选出实时显示所用的样本，多个设备同时上报时只保留优先设备的样本
+	Prefer func(ctx context.Context, userID uint, samples []models.HeartRateData) []models.HeartRateData
+
+	mu       sync.Mutex
+	capacity int
+	rules    map[uint]ruleEntry
+}
+
+func NewEngine(db *gorm.DB, redis redis.UniversalClient, store *storage.HeartRateStore, gap time.Duration, cacheSize int) *Engine {
+	if cacheSize <= 0 {
+		cacheSize = 1
+	}
+	return &Engine{
+		DB:       db,
+		Redis:    redis,
+		Store:    store,
+		Gap:      gap,
+		capacity: cacheSize,
+		rules:    make(map[uint]ruleEntry),
+	}
+}
+
+func lastSeenKey(userID uint) string {
+	return storage.UserKey("alert_last_seen", userID)
+}
+
+// Invalidate 清除用户规则在本实例的缓存，规则修改后调用
+func (e *Engine) Invalidate(userID uint) {
+	e.mu.Lock()
+	delete(e.rules, userID)
+	e.mu.Unlock()
+}
+
+// DeleteUser 清除已删除用户的规则缓存和最后上报时间
+func (e *Engine) DeleteUser(ctx context.Context, userID uint) error {
+	e.Invalidate(userID)
+	return e.Redis.Del(ctx, lastSeenKey(userID)).Err()
+}
+
+// enabledRules 返回用户启用的规则，没有规则的用户同样缓存，避免每个样本都查询数据库
+func (e *Engine) enabledRules(ctx context.Context, userID uint) ([]models.AlertRule, error) {
+	e.mu.Lock()
+	entry, ok := e.rules[userID]
+	e.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.rules, nil
+	}
+
+	var rules []models.AlertRule
+	if err := e.DB.WithContext(ctx).Where("user_id = ? AND enabled = ?", userID, true).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.rules) >= e.capacity {
+		e.rules = make(map[uint]ruleEntry)
+	}
+	e.rules[userID] = ruleEntry{rules: rules, expiresAt: time.Now().Add(ruleCacheTTL)}
+	return rules, nil
+}
+
+// Evaluate 用刚收到的样本及之前的样本检查用户的规则，错误只记录日志，不影响上报。
+// 多个设备同时上报时只用优先设备的样本检查
+func (e *Engine) Evaluate(ctx context.Context, userID uint, data models.HeartRateData) {
+	rules, err := e.enabledRules(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load alert rules for user %d: %v", userID, err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	var longest time.Duration
+	noData := false
+	for _, rule := range rules {
+		if rule.Type == models.AlertTypeNoData {
+			noData = true
+			continue
+		}
+		longest = max(longest, time.Duration(rule.Duration)*time.Second)
+	}
+	if noData {
+		if err := e.Redis.Set(ctx, lastSeenKey(userID), data.MeasuredAt, lastSeenTTL).Err(); err != nil {
+			log.Printf("Failed to record last seen for user %d: %v", userID, err)
+		}
+	}
+
+	var samples []models.HeartRateData
+	preferred := true
+	if longest > 0 {
+		from := data.MeasuredAt - (longest + e.Gap).Milliseconds()
+		if samples, err = e.Store.Range(ctx, userID, from, data.MeasuredAt); err != nil {
+			log.Printf("Failed to load samples for alert rules of user %d: %v", userID, err)
+			return
+		}
+		// Redis不可用时样本还在缓冲区中
+		if len(samples) == 0 || samples[len(samples)-1].MeasuredAt < data.MeasuredAt {
+			samples = append(samples, data)
+		}
+		samples, preferred = e.selectPreferred(ctx, userID, samples, data)
+	}
+
+	changed := false
+	for _, rule := range rules {
+		if !preferred && rule.Type != models.AlertTypeNoData {
+			continue
+		}
+		result, value := check(rule, samples, data.MeasuredAt, e.Gap)
+		ok, err := e.transition(ctx, rule, result, value)
+		if err != nil {
+			log.Printf("Failed to update alert rule %d: %v", rule.ID, err)
+		}
+		changed = changed || ok
+	}
+	if changed {
+		e.Invalidate(userID)
+	}
+}
+
+// selectPreferred 用 Prefer 筛选样本，并判断刚收到的 data 是否为优先设备的样本。
+// 被优先设备取代的样本不改变阈值规则的状态
+func (e *Engine) selectPreferred(ctx context.Context, userID uint, samples []models.HeartRateData, data models.HeartRateData) ([]models.HeartRateData, bool) {
+	if e.Prefer == nil {
+		return samples, true
+	}
+	samples = e.Prefer(ctx, userID, samples)
+	last := len(samples) - 1
+	return samples, last >= 0 && samples[last].MeasuredAt == data.MeasuredAt && samples[last].DeviceID == data.DeviceID
+}
+
+// transition 按检查结论更新规则状态并写入告警记录，返回状态是否变化。
+// 恢复后冷却期内满足条件的规则保持正常状态，冷却结束后仍满足条件再触发
+func (e *Engine) transition(ctx context.Context, rule models.AlertRule, result verdict, value float64) (bool, error) {
+	now := time.Now()
+	var event models.AlertEvent
+	var tx *gorm.DB
+
+	switch {
+	case result == verdictFire && rule.State != models.AlertStateFiring:
+		cutoff := now.Add(-time.Duration(rule.Cooldown) * time.Second)
+		if rule.LastResolvedAt != nil && rule.LastResolvedAt.After(cutoff) {
+			return false, nil
+		}
+		tx = e.DB.WithContext(ctx).Model(&models.AlertRule{}).
+			Where("id = ? AND state = ? AND (last_resolved_at IS NULL OR last_resolved_at <= ?)", rule.ID, models.AlertStateOK, cutoff).
+			Updates(map[string]interface{}{"state": models.AlertStateFiring, "last_fired_at": now})
+		event.State = models.AlertStateFiring
+	case result == verdictClear && rule.State == models.AlertStateFiring:
+		tx = e.DB.WithContext(ctx).Model(&models.AlertRule{}).
+			Where("id = ? AND state = ?", rule.ID, models.AlertStateFiring).
+			Updates(map[string]interface{}{"state": models.AlertStateOK, "last_resolved_at": now})
+		event.State = models.AlertStateResolved
+	default:
+		return false, nil
+	}
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	// 其它实例已经完成了这次状态变化
+	if tx.RowsAffected == 0 {
+		return true, nil
+	}
+
+	event.UserID = rule.UserID
+	event.RuleID = rule.ID
+	event.RuleName = rule.Name
+	event.Type = rule.Type
+	event.Value = value
+	event.Threshold = rule.Threshold
+	if err := e.DB.WithContext(ctx).Create(&event).Error; err != nil {
+		return true, err
+	}
+	log.Printf("Alert rule %d of user %d %s (value %.1f)", rule.ID, rule.UserID, event.State, value)
+	if e.OnEvent != nil {
+		e.OnEvent(ctx, event)
+	}
+	return true, nil
+}
+
+// Run 定时检查未上报规则，阻塞直到 ctx 结束
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(noDataInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.checkNoData(ctx)
+		}
+	}
+}
+
+// checkNoData 触发超过时长没有上报的规则。从未上报过或最后上报时间已过期的用户不触发
+func (e *Engine) checkNoData(ctx context.Context) {
+	var rules []models.AlertRule
+	err := e.DB.WithContext(ctx).
+		Where("type = ? AND enabled = ? AND state = ?", models.AlertTypeNoData, true, models.AlertStateOK).
+		Find(&rules).Error
+	if err != nil {
+		log.Printf("Failed to load no-data alert rules: %v", err)
+		return
+	}
+
+	now := utils.CurrentMillis()
+	for _, rule := range rules {
+		value, err := e.Redis.Get(ctx, lastSeenKey(rule.UserID)).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				log.Printf("Failed to read last seen for user %d: %v", rule.UserID, err)
+			}
+			continue
+		}
+		lastSeen, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		silence := time.Duration(now-lastSeen) * time.Millisecond
+		if silence < time.Duration(rule.Duration)*time.Second {
+			continue
+		}
+		changed, err := e.transition(ctx, rule, verdictFire, math.Round(silence.Seconds()))
+		if err != nil {
+			log.Printf("Failed to update alert rule %d: %v", rule.ID, err)
+		}
+		if changed {
+			e.Invalidate(rule.UserID)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package alert 按用户的告警规则检查上报的心率，规则状态和告警记录保存在数据库
+package alert
+
+import (
+	"heart-rate-server/internal/models"
+	"math"
+	"time"
+)
+
+// verdict 一次检查对规则状态的结论
+type verdict int
+
+const (
+	// verdictHold 保持当前状态（处于两个阈值之间，或数据不足以判断）
+	verdictHold verdict = iota
+	verdictFire
+	verdictClear
+)
+
+// window 返回 (to-d, to] 内的样本，连同此前的最后一个样本（其数值持续到时间段开始），
+// 以及这些样本是否连续覆盖整个时间段：此前的样本距时间段开始、相邻样本之间都不超过 gap
+func window(samples []models.HeartRateData, to int64, d, gap time.Duration) ([]models.HeartRateData, bool) {
+	from := to - d.Milliseconds()
+	start := len(samples)
+	for i, sample := range samples {
+		if sample.MeasuredAt > from {
+			start = i
+			break
+		}
+	}
+	if start == len(samples) {
+		return nil, false
+	}
+
+	maxGap := gap.Milliseconds()
+	covered := start > 0 && from-samples[start-1].MeasuredAt <= maxGap
+	if start > 0 {
+		start--
+	}
+	selected := samples[start:]
+	for i := 1; covered && i < len(selected); i++ {
+		covered = selected[i].MeasuredAt-selected[i-1].MeasuredAt <= maxGap
+	}
+	return selected, covered
+}
+
+// check 用按时间排序、以 at 结束的样本检查规则，返回结论和观测值。
+// 未上报规则由定时任务触发，这里只在收到数据时恢复
+func check(rule models.AlertRule, samples []models.HeartRateData, at int64, gap time.Duration) (verdict, float64) {
+	if rule.Type == models.AlertTypeNoData {
+		return verdictClear, 0
+	}
+
+	selected, covered := window(samples, at, time.Duration(rule.Duration)*time.Second, gap)
+	if len(selected) == 0 {
+		return verdictHold, 0
+	}
+	latest := selected[len(selected)-1].Data.HeartRate
+
+	switch rule.Type {
+	case models.AlertTypeAbove:
+		lowest := latest
+		for _, sample := range selected {
+			lowest = min(lowest, sample.Data.HeartRate)
+		}
+		switch {
+		case covered && lowest > rule.Threshold:
+			return verdictFire, float64(lowest)
+		case latest < rule.Threshold-rule.Hysteresis:
+			return verdictClear, float64(latest)
+		}
+		return verdictHold, float64(latest)
+
+	case models.AlertTypeAverageBelow:
+		sum := 0
+		for _, sample := range selected {
+			sum += sample.Data.HeartRate
+		}
+		avg := math.Round(float64(sum)/float64(len(selected))*10) / 10
+		switch {
+		case covered && avg < float64(rule.Threshold):
+			return verdictFire, avg
+		case avg >= float64(rule.Threshold+rule.Hysteresis):
+			return verdictClear, avg
+		}
+		return verdictHold, avg
+
+	case models.AlertTypeJump:
+		lowest, highest := latest, latest
+		for _, sample := range selected {
+			lowest = min(lowest, sample.Data.HeartRate)
+			highest = max(highest, sample.Data.HeartRate)
+		}
+		change := max(latest-lowest, highest-latest)
+		switch {
+		case change >= rule.Threshold:
+			return verdictFire, float64(change)
+		case change < max(rule.Threshold-rule.Hysteresis, 1):
+			return verdictClear, float64(change)
+		}
+		return verdictHold, float64(change)
+	}
+	return verdictHold, 0
+}
@@ -0,0 +1,240 @@
+package alert
+
+import (
+	"context"
+	"heart-rate-server/internal/models"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testGap = 5 * time.Second
+
+// series 从 start 毫秒开始每秒一个样本
+func series(start int64, device uint, heartRates ...int) []models.HeartRateData {
+	samples := make([]models.HeartRateData, len(heartRates))
+	for i, hr := range heartRates {
+		samples[i].MeasuredAt = start + int64(i)*1000
+		samples[i].DeviceID = device
+		samples[i].Data.HeartRate = hr
+	}
+	return samples
+}
+
+func repeat(n, v int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = v
+	}
+	return values
+}
+
+func rule(ruleType string, threshold, duration, hysteresis int) models.AlertRule {
+	return models.AlertRule{Type: ruleType, Threshold: threshold, Duration: duration, Hysteresis: hysteresis}
+}
+
+func TestCheck(t *testing.T) {
+	above := rule(models.AlertTypeAbove, 120, 10, 5)
+	averageBelow := rule(models.AlertTypeAverageBelow, 60, 10, 5)
+	jump := rule(models.AlertTypeJump, 30, 10, 5)
+
+	dip := append(repeat(6, 130), 115)
+	dip = append(dip, repeat(6, 130)...)
+	gapped := append(series(0, 0, repeat(5, 130)...), series(12000, 0, repeat(5, 130)...)...)
+
+	cases := []struct {
+		name      string
+		rule      models.AlertRule
+		samples   []models.HeartRateData
+		want      verdict
+		wantValue float64
+	}{
+		{"above fires when covered", above, series(0, 0, repeat(13, 130)...), verdictFire, 130},
+		{"above holds until duration is covered", above, series(0, 0, repeat(6, 130)...), verdictHold, 130},
+		{"above holds after a dip inside the window", above, series(0, 0, dip...), verdictHold, 130},
+		{"above holds across a gap", above, gapped, verdictHold, 130},
+		{"above holds within hysteresis", above, series(0, 0, 130, 130, 117), verdictHold, 117},
+		{"above clears below hysteresis", above, series(0, 0, 130, 130, 114), verdictClear, 114},
+		{"above holds at exactly threshold minus hysteresis", above, series(0, 0, 130, 115), verdictHold, 115},
+		{"average below fires when covered", averageBelow, series(0, 0, repeat(13, 50)...), verdictFire, 50},
+		{"average below holds until covered", averageBelow, series(0, 0, repeat(5, 50)...), verdictHold, 50},
+		{"average below holds within hysteresis", averageBelow, series(0, 0, repeat(13, 62)...), verdictHold, 62},
+		{"average below clears above hysteresis", averageBelow, series(0, 0, repeat(13, 65)...), verdictClear, 65},
+		{"jump fires on rise", jump, series(0, 0, 80, 90, 115), verdictFire, 35},
+		{"jump fires on drop", jump, series(0, 0, 120, 100, 88), verdictFire, 32},
+		{"jump ignores samples before the window", jump, series(0, 0, append([]int{40}, repeat(12, 80)...)...), verdictClear, 0},
+		{"jump holds within hysteresis", jump, series(0, 0, 80, 107), verdictHold, 27},
+		{"jump clears below hysteresis", jump, series(0, 0, 80, 100), verdictClear, 20},
+		{"no data clears on any sample", rule(models.AlertTypeNoData, 0, 60, 0), series(0, 0, 80), verdictClear, 0},
+		{"no samples hold", above, nil, verdictHold, 0},
+	}
+	for _, tc := range cases {
+		at := int64(0)
+		if len(tc.samples) > 0 {
+			at = tc.samples[len(tc.samples)-1].MeasuredAt
+		}
+		got, value := check(tc.rule, tc.samples, at, testGap)
+		if got != tc.want || value != tc.wantValue {
+			t.Errorf("%s: got verdict %d value %v, want %d %v", tc.name, got, value, tc.want, tc.wantValue)
+		}
+	}
+}
+
+func TestWindowCoverage(t *testing.T) {
+	cases := []struct {
+		name        string
+		samples     []models.HeartRateData
+		to          int64
+		wantLen     int
+		wantCovered bool
+	}{
+		{"continuous", series(0, 0, repeat(13, 80)...), 12000, 11, true},
+		{"no sample before the window", series(3000, 0, repeat(10, 80)...), 12000, 10, false},
+		{"previous sample too old", append(series(0, 0, 80), series(8000, 0, repeat(5, 80)...)...), 12000, 6, false},
+		{"gap inside the window", append(series(0, 0, repeat(4, 80)...), series(10000, 0, repeat(3, 80)...)...), 12000, 5, false},
+		{"gap equal to the limit", append(series(0, 0, repeat(4, 80)...), series(8000, 0, repeat(5, 80)...)...), 12000, 7, true},
+		{"all samples too old", series(0, 0, 80, 80), 12000, 0, false},
+	}
+	for _, tc := range cases {
+		selected, covered := window(tc.samples, tc.to, 10*time.Second, testGap)
+		if len(selected) != tc.wantLen || covered != tc.wantCovered {
+			t.Errorf("%s: got %d samples covered %v, want %d %v", tc.name, len(selected), covered, tc.wantLen, tc.wantCovered)
+		}
+	}
+}
+
+// dropDevice 模拟优先级筛选：丢弃指定设备的样本
+func dropDevice(device uint) func(context.Context, uint, []models.HeartRateData) []models.HeartRateData {
+	return func(_ context.Context, _ uint, samples []models.HeartRateData) []models.HeartRateData {
+		kept := make([]models.HeartRateData, 0, len(samples))
+		for _, sample := range samples {
+			if sample.DeviceID != device {
+				kept = append(kept, sample)
+			}
+		}
+		return kept
+	}
+}
+
+func TestSelectPreferred(t *testing.T) {
+	// 主设备 1 稳定在 80，副设备 2 的读数跳到 150
+	samples := series(0, 1, repeat(10, 80)...)
+	secondary := models.HeartRateData{MeasuredAt: 9500, DeviceID: 2}
+	secondary.Data.HeartRate = 150
+	samples = append(samples, secondary)
+	jump := rule(models.AlertTypeJump, 30, 10, 5)
+
+	if got, _ := check(jump, samples, secondary.MeasuredAt, testGap); got != verdictFire {
+		t.Fatalf("unfiltered samples: got verdict %d, want fire", got)
+	}
+
+	e := &Engine{Prefer: dropDevice(2)}
+	selected, preferred := e.selectPreferred(context.Background(), 1, samples, secondary)
+	if preferred {
+		t.Fatal("sample from the secondary device should not be preferred")
+	}
+	if len(selected) != 10 {
+		t.Fatalf("got %d samples, want 10", len(selected))
+	}
+
+	primary := samples[9]
+	if _, preferred := e.selectPreferred(context.Background(), 1, samples[:10], primary); !preferred {
+		t.Fatal("sample from the primary device should be preferred")
+	}
+
+	e.Prefer = nil
+	if selected, preferred := e.selectPreferred(context.Background(), 1, samples, secondary); !preferred || len(selected) != len(samples) {
+		t.Fatal("without Prefer every sample should be used")
+	}
+}
+
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接独立，只使用一个连接
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.AlertRule{}, &models.AlertEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	return &Engine{DB: db}
+}
+
+func ago(d time.Duration) *time.Time {
+	t := time.Now().Add(-d)
+	return &t
+}
+
+func TestTransitionCooldown(t *testing.T) {
+	cases := []struct {
+		name         string
+		lastFired    *time.Time
+		lastResolved *time.Time
+		wantFired    bool
+	}{
+		{"never fired", nil, nil, true},
+		{"resolved within cooldown", ago(20 * time.Minute), ago(time.Minute), false},
+		{"resolved after cooldown", ago(20 * time.Minute), ago(10 * time.Minute), true},
+		// 冷却从恢复开始计算：触发虽然很久以前，刚刚恢复仍在冷却期内
+		{"fired long ago but resolved recently", ago(time.Hour), ago(30 * time.Second), false},
+	}
+	for _, tc := range cases {
+		e := newTestEngine(t)
+		r := models.AlertRule{UserID: 1, Name: tc.name, Type: models.AlertTypeAbove, Threshold: 120, Duration: 10,
+			Cooldown: 300, Enabled: true, State: models.AlertStateOK, LastFiredAt: tc.lastFired, LastResolvedAt: tc.lastResolved}
+		if err := e.DB.Create(&r).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		changed, err := e.transition(context.Background(), r, verdictFire, 130)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var stored models.AlertRule
+		e.DB.First(&stored, r.ID)
+		var events int64
+		e.DB.Model(&models.AlertEvent{}).Where("rule_id = ?", r.ID).Count(&events)
+		fired := stored.State == models.AlertStateFiring
+		if changed != tc.wantFired || fired != tc.wantFired || (events == 1) != tc.wantFired {
+			t.Errorf("%s: changed %v state %s events %d, want fired %v", tc.name, changed, stored.State, events, tc.wantFired)
+		}
+	}
+}
+
+func TestTransitionRecordsRecovery(t *testing.T) {
+	e := newTestEngine(t)
+	r := models.AlertRule{UserID: 1, Name: "high", Type: models.AlertTypeAbove, Threshold: 120, Duration: 10,
+		Cooldown: 300, Enabled: true, State: models.AlertStateFiring, LastFiredAt: ago(time.Minute)}
+	if err := e.DB.Create(&r).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if changed, err := e.transition(context.Background(), r, verdictClear, 100); err != nil || !changed {
+		t.Fatalf("got changed %v err %v, want resolved", changed, err)
+	}
+	var stored models.AlertRule
+	e.DB.First(&stored, r.ID)
+	if stored.State != models.AlertStateOK || stored.LastResolvedAt == nil || stored.LastResolvedAt.Before(before.Add(-time.Second)) {
+		t.Fatalf("got state %s resolved at %v, want ok and recent", stored.State, stored.LastResolvedAt)
+	}
+	var event models.AlertEvent
+	if err := e.DB.Where("rule_id = ?", r.ID).First(&event).Error; err != nil || event.State != models.AlertStateResolved {
+		t.Fatalf("got event %+v err %v, want resolved event", event, err)
+	}
+
+	// 刚恢复的规则在冷却期内不再触发
+	if changed, err := e.transition(context.Background(), stored, verdictFire, 130); err != nil || changed {
+		t.Fatalf("got changed %v err %v, want cooldown", changed, err)
+	}
+}
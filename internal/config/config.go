@@ -6,9 +6,17 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Redis部署模式
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
 type Config struct {
 	ServerPort     string
 	DBDSN          string
@@ -19,6 +27,49 @@ type Config struct {
 	CookieBlockKey []byte
 	BcryptCost     int
 	TokenExpiry    time.Duration
+	UUIDCacheSize  int
+
+	// DevMode 开发模式下每次请求从工作目录重新读取模板和静态资源
+	DevMode bool
+
+	// 心率数据新鲜度阈值：超过 StaleAfter 视为过期，超过 OfflineAfter 视为离线
+	StaleAfter   time.Duration
+	OfflineAfter time.Duration
+	// 每个用户保留的历史样本窗口，决定趋势图可查询的最长时间
+	HistoryWindow time.Duration
+	// 样本归档到数据库的保留时长，供回放使用，0 表示不归档
+	ArchiveRetention time.Duration
+	// 单次回放允许的最长时间范围，以及回放会话的有效期
+	ReplayMaxRange   time.Duration
+	ReplaySessionTTL time.Duration
+
+	// Redis高可用：Sentinel 使用 RedisAddrs 作为哨兵地址，Cluster 使用其作为种子节点
+	RedisMode             string
+	RedisAddrs            []string
+	RedisUsername         string
+	RedisMasterName       string
+	RedisSentinelPassword string
+
+	// Redis TLS
+	RedisTLS                   bool
+	RedisTLSServerName         string
+	RedisTLSCAFile             string
+	RedisTLSInsecureSkipVerify bool
+
+	// Redis熔断与缓冲
+	RedisBreakerThreshold int
+	RedisBreakerCooldown  time.Duration
+	HeartRateBufferSize   int
+
+	// 启动时连接Redis与数据库的重试策略
+	StartupRetryAttempts int
+	StartupRetryMaxDelay time.Duration
+
+	// Webhook投递：每个实例的并发数、单次请求超时、最多尝试次数，以及是否允许投递到内网地址
+	WebhookWorkers      int
+	WebhookTimeout      time.Duration
+	WebhookMaxAttempts  int
+	WebhookAllowPrivate bool
 }
 
 func (c *Config) Validate() error {
@@ -31,6 +82,43 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database path should be absolute path")
 	}
 
+	switch c.RedisMode {
+	case RedisModeSingle:
+	case RedisModeSentinel:
+		if c.RedisMasterName == "" || len(c.RedisAddrs) == 0 {
+			return fmt.Errorf("redis sentinel mode requires REDIS_MASTER_NAME and REDIS_ADDRS")
+		}
+	case RedisModeCluster:
+		if len(c.RedisAddrs) == 0 {
+			return fmt.Errorf("redis cluster mode requires REDIS_ADDRS")
+		}
+		if c.RedisDB != 0 {
+			return fmt.Errorf("redis cluster mode only supports database 0")
+		}
+	default:
+		return fmt.Errorf("unknown redis mode %q", c.RedisMode)
+	}
+
+	if c.StaleAfter <= 0 || c.OfflineAfter <= c.StaleAfter {
+		return fmt.Errorf("offline threshold must be greater than stale threshold")
+	}
+
+	if c.HistoryWindow < time.Minute {
+		return fmt.Errorf("history window must be at least one minute")
+	}
+
+	if c.ArchiveRetention < 0 {
+		return fmt.Errorf("archive retention must not be negative")
+	}
+
+	if c.ReplayMaxRange < time.Minute || c.ReplaySessionTTL < time.Minute {
+		return fmt.Errorf("replay max range and session TTL must be at least one minute")
+	}
+
+	if c.WebhookWorkers < 1 || c.WebhookMaxAttempts < 1 || c.WebhookTimeout <= 0 {
+		return fmt.Errorf("webhook workers, max attempts and timeout must be positive")
+	}
+
 	return nil
 }
 
@@ -38,12 +126,44 @@ func Load() (*Config, error) {
 	// Set defaults
 	cfg := &Config{
 		ServerPort:    getEnv("SERVER_PORT", "8080"),
+		DevMode:       getEnvAsBool("DEV_MODE", false),
 		DBDSN:         getEnv("DB_DSN", "heartrate.db"),
 		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
 		RedisDB:       getEnvAsInt("REDIS_DB", 0),
 		BcryptCost:    getEnvAsInt("BCRYPT_COST", 10),
 		TokenExpiry:   24 * time.Hour,
+		UUIDCacheSize: getEnvAsInt("UUID_CACHE_SIZE", 10000),
+		StaleAfter:    getEnvAsDuration("HEART_RATE_STALE_AFTER", 10*time.Second),
+		OfflineAfter:  getEnvAsDuration("HEART_RATE_OFFLINE_AFTER", 60*time.Second),
+		HistoryWindow: getEnvAsDuration("HEART_RATE_HISTORY_WINDOW", 30*time.Minute),
+
+		ArchiveRetention: getEnvAsDuration("HEART_RATE_ARCHIVE_RETENTION", 30*24*time.Hour),
+		ReplayMaxRange:   getEnvAsDuration("REPLAY_MAX_RANGE", 6*time.Hour),
+		ReplaySessionTTL: getEnvAsDuration("REPLAY_SESSION_TTL", 24*time.Hour),
+
+		RedisMode:             getEnv("REDIS_MODE", RedisModeSingle),
+		RedisAddrs:            getEnvAsList("REDIS_ADDRS"),
+		RedisUsername:         getEnv("REDIS_USERNAME", ""),
+		RedisMasterName:       getEnv("REDIS_MASTER_NAME", ""),
+		RedisSentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+
+		RedisTLS:                   getEnvAsBool("REDIS_TLS", false),
+		RedisTLSServerName:         getEnv("REDIS_TLS_SERVER_NAME", ""),
+		RedisTLSCAFile:             getEnv("REDIS_TLS_CA_FILE", ""),
+		RedisTLSInsecureSkipVerify: getEnvAsBool("REDIS_TLS_INSECURE_SKIP_VERIFY", false),
+
+		RedisBreakerThreshold: getEnvAsInt("REDIS_BREAKER_THRESHOLD", 5),
+		RedisBreakerCooldown:  getEnvAsDuration("REDIS_BREAKER_COOLDOWN", 10*time.Second),
+		HeartRateBufferSize:   getEnvAsInt("HEART_RATE_BUFFER_SIZE", 10000),
+
+		StartupRetryAttempts: getEnvAsInt("STARTUP_RETRY_ATTEMPTS", 10),
+		StartupRetryMaxDelay: getEnvAsDuration("STARTUP_RETRY_MAX_DELAY", 30*time.Second),
+
+		WebhookWorkers:      getEnvAsInt("WEBHOOK_WORKERS", 4),
+		WebhookTimeout:      getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts:  getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 6),
+		WebhookAllowPrivate: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE", false),
 	}
 
 	// Load cookie keys
@@ -59,6 +179,11 @@ func Load() (*Config, error) {
 	}
 	cfg.CookieBlockKey = blockKey
 
+	// 未配置 REDIS_ADDRS 时沿用单节点地址
+	if len(cfg.RedisAddrs) == 0 && cfg.RedisMode != RedisModeSingle {
+		cfg.RedisAddrs = []string{cfg.RedisAddr}
+	}
+
 	return cfg, nil
 }
 
@@ -81,6 +206,41 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+func getEnvAsBool(key string, defaultValue bool) bool {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(strValue)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsList 解析逗号分隔的列表，忽略空项
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, item := range strings.Split(getEnv(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(strValue)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 func decodeHexKey(hexKey string, expectedBytes int) ([]byte, error) {
 	if hexKey == "" {
 		return nil, nil
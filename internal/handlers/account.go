@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// RegenerateUUIDHandler 重新生成UUID，旧的公开链接随即失效
+func (app *App) RegenerateUUIDHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var user models.User
+	if err := app.DB.First(&user, authInfo.UserID).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	oldUUID := user.UUID
+	newUUID := uuid.New().String()
+	if err := app.DB.Model(&user).Update("uuid", newUUID).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to update UUID")
+		return
+	}
+
+	if err := app.UUIDCache.Invalidate(r.Context(), oldUUID); err != nil {
+		log.Printf("Failed to invalidate UUID cache for %s: %v", oldUUID, err)
+	}
+
+	utils.SendResponse(w, http.StatusOK, "UUID regenerated", map[string]string{"uuid": newUUID})
+}
+
+// DeleteAccountHandler 校验密码后删除账户及其心率数据
+func (app *App) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	var user models.User
+	if err := app.DB.First(&user, authInfo.UserID).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		utils.SendError(w, http.StatusUnauthorized, nil, "Invalid password")
+		return
+	}
+
+	// 删除后需要清除缓存的分享链接和设备令牌
+	var shareHashes, deviceHashes []string
+	err := app.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ShareLink{}).Unscoped().Where("user_id = ?", user.ID).Pluck("token_hash", &shareHashes).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Device{}).Unscoped().Where("user_id = ?", user.ID).Pluck("token_hash", &deviceHashes).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.WidgetPreset{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.CustomWidget{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.HeartRateSample{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.ShareLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.PrivacySettings{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Device{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.UserProfile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.AlertRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.AlertEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id IN (?)", tx.Model(&models.Webhook{}).Select("id").Where("user_id = ?", user.ID)).
+			Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Webhook{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to delete account")
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.UUIDCache.Invalidate(ctx, user.UUID); err != nil {
+		log.Printf("Failed to invalidate UUID cache for %s: %v", user.UUID, err)
+	}
+	if err := app.SignedLinks.Invalidate(ctx, user.ID); err != nil {
+		log.Printf("Failed to invalidate widget secret cache for user %d: %v", user.ID, err)
+	}
+	for _, hash := range shareHashes {
+		if err := app.ShareLinks.Invalidate(ctx, hash); err != nil {
+			log.Printf("Failed to invalidate share link cache: %v", err)
+		}
+	}
+	for _, hash := range deviceHashes {
+		if err := app.Devices.Invalidate(ctx, hash); err != nil {
+			log.Printf("Failed to broadcast device deletion: %v", err)
+		}
+	}
+	deviceRanks.delete(user.ID)
+	if err := app.Store.Delete(ctx, user.ID); err != nil {
+		log.Printf("Failed to delete heart rate data for user %d: %v", user.ID, err)
+	}
+	// 事务提交后仍可能有队列中的样本写入归档
+	if err := app.Archive.Delete(ctx, user.ID); err != nil {
+		log.Printf("Failed to delete archived heart rate data for user %d: %v", user.ID, err)
+	}
+	if err := app.Replays.DeleteUser(ctx, user.ID); err != nil {
+		log.Printf("Failed to delete replay sessions for user %d: %v", user.ID, err)
+	}
+	if err := app.Alerts.DeleteUser(ctx, user.ID); err != nil {
+		log.Printf("Failed to delete alert state for user %d: %v", user.ID, err)
+	}
+	if err := app.Webhooks.DeleteUser(ctx, user.ID); err != nil {
+		log.Printf("Failed to delete webhook state for user %d: %v", user.ID, err)
+	}
+
+	app.SecureCookie.ClearAuthCookie(w)
+	utils.SendResponse(w, http.StatusOK, "Account deleted", nil)
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxAlertRules 每个用户最多的告警规则数
+	maxAlertRules = 20
+
+	defaultAlertHysteresis = 5
+	defaultAlertCooldown   = 300
+
+	// 持续条件的最短时长；未上报规则的最短时长
+	minAlertDuration  = 5
+	minNoDataDuration = 60
+
+	defaultAlertHistoryLimit = 50
+	maxAlertHistoryLimit     = 500
+)
+
+func newAlertRuleResponse(rule models.AlertRule) models.AlertRuleResponse {
+	resp := models.AlertRuleResponse{
+		ID:         rule.ID,
+		Name:       rule.Name,
+		Type:       rule.Type,
+		Threshold:  rule.Threshold,
+		Duration:   rule.Duration,
+		Hysteresis: rule.Hysteresis,
+		Cooldown:   rule.Cooldown,
+		Enabled:    rule.Enabled,
+		State:      rule.State,
+		CreatedAt:  utils.TimeToMillis(rule.CreatedAt),
+	}
+	if rule.LastFiredAt != nil {
+		resp.LastFiredAt = utils.TimeToMillis(*rule.LastFiredAt)
+	}
+	if rule.LastResolvedAt != nil {
+		resp.LastResolvedAt = utils.TimeToMillis(*rule.LastResolvedAt)
+	}
+	return resp
+}
+
+// applyAlertRuleRequest 检查与类型相关的取值并写入规则，修改后规则回到正常状态。
+// 持续条件依赖Redis中的样本，时长不能超过 HistoryWindow
+func (app *App) applyAlertRuleRequest(rule *models.AlertRule, req models.AlertRuleRequest) error {
+	if req.Type == models.AlertTypeNoData {
+		if req.Duration < minNoDataDuration {
+			return fmt.Errorf("duration must be at least %d seconds", minNoDataDuration)
+		}
+	} else {
+		if req.Threshold == 0 {
+			return fmt.Errorf("threshold is required")
+		}
+		limit := int(app.Config.HistoryWindow / time.Second)
+		if req.Duration < minAlertDuration || req.Duration > limit {
+			return fmt.Errorf("duration must be between %d-%d seconds", minAlertDuration, limit)
+		}
+	}
+
+	rule.Name = req.Name
+	rule.Type = req.Type
+	rule.Threshold = req.Threshold
+	rule.Duration = req.Duration
+	rule.Hysteresis = defaultAlertHysteresis
+	if req.Hysteresis != nil {
+		rule.Hysteresis = *req.Hysteresis
+	}
+	rule.Cooldown = defaultAlertCooldown
+	if req.Cooldown != nil {
+		rule.Cooldown = *req.Cooldown
+	}
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	// 修改触发中的规则视为恢复，冷却从此时开始
+	if rule.State == models.AlertStateFiring {
+		now := time.Now()
+		rule.LastResolvedAt = &now
+	}
+	rule.State = models.AlertStateOK
+	return nil
+}
+
+func decodeAlertRuleRequest(w http.ResponseWriter, r *http.Request) (models.AlertRuleRequest, bool) {
+	var req models.AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return req, false
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return req, false
+	}
+	return req, true
+}
+
+// ListAlertRulesHandler 列出当前用户的告警规则
+func (app *App) ListAlertRulesHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var rules []models.AlertRule
+	if err := app.DB.Where("user_id = ?", authInfo.UserID).Order("id").Find(&rules).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	resp := make([]models.AlertRuleResponse, 0, len(rules))
+	for _, rule := range rules {
+		resp = append(resp, newAlertRuleResponse(rule))
+	}
+	utils.SendResponse(w, http.StatusOK, "", resp)
+}
+
+// CreateAlertRuleHandler 创建告警规则
+func (app *App) CreateAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	req, ok := decodeAlertRuleRequest(w, r)
+	if !ok {
+		return
+	}
+	rule := models.AlertRule{UserID: authInfo.UserID}
+	if err := app.applyAlertRuleRequest(&rule, req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	var count int64
+	if err := app.DB.Model(&models.AlertRule{}).Where("user_id = ?", authInfo.UserID).Count(&count).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+	if count >= maxAlertRules {
+		utils.SendError(w, http.StatusConflict, nil, "Too many alert rules")
+		return
+	}
+
+	if err := app.DB.Create(&rule).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to create alert rule")
+		return
+	}
+	app.Alerts.Invalidate(authInfo.UserID)
+
+	utils.SendResponse(w, http.StatusCreated, "Alert rule created", newAlertRuleResponse(rule))
+}
+
+// UpdateAlertRuleHandler 修改告警规则，规则回到正常状态，冷却时间从上次恢复起计算
+func (app *App) UpdateAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	rule, ok := app.findAlertRule(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+	req, ok := decodeAlertRuleRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := app.applyAlertRuleRequest(&rule, req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	if err := app.DB.Save(&rule).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to update alert rule")
+		return
+	}
+	app.Alerts.Invalidate(authInfo.UserID)
+
+	utils.SendResponse(w, http.StatusOK, "Alert rule updated", newAlertRuleResponse(rule))
+}
+
+// DeleteAlertRuleHandler 删除告警规则，已有的告警记录保留
+func (app *App) DeleteAlertRuleHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	rule, ok := app.findAlertRule(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+	if err := app.DB.Unscoped().Delete(&rule).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to delete alert rule")
+		return
+	}
+	app.Alerts.Invalidate(authInfo.UserID)
+
+	utils.SendResponse(w, http.StatusOK, "Alert rule deleted", nil)
+}
+
+func (app *App) findAlertRule(w http.ResponseWriter, r *http.Request, userID uint) (models.AlertRule, bool) {
+	var rule models.AlertRule
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid alert rule ID")
+		return rule, false
+	}
+	if err := app.DB.Where("id = ? AND user_id = ?", id, userID).First(&rule).Error; err != nil {
+		utils.SendError(w, http.StatusNotFound, nil, "Alert rule not found")
+		return rule, false
+	}
+	return rule, true
+}
+
+// AlertHistoryHandler 当前用户的告警记录，按时间倒序，支持 ?limit= 和 ?rule_id=
+func (app *App) AlertHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+	query := r.URL.Query()
+
+	limit := defaultAlertHistoryLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAlertHistoryLimit {
+			utils.SendError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1-%d", maxAlertHistoryLimit), "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	tx := app.DB.Where("user_id = ?", authInfo.UserID)
+	if v := query.Get("rule_id"); v != "" {
+		ruleID, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			utils.SendError(w, http.StatusBadRequest, err, "Invalid alert rule ID")
+			return
+		}
+		tx = tx.Where("rule_id = ?", ruleID)
+	}
+
+	var events []models.AlertEvent
+	if err := tx.Order("created_at DESC, id DESC").Limit(limit).Find(&events).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	resp := make([]models.AlertEventResponse, 0, len(events))
+	for _, event := range events {
+		resp = append(resp, models.AlertEventResponse{
+			ID:        event.ID,
+			RuleID:    event.RuleID,
+			RuleName:  event.RuleName,
+			Type:      event.Type,
+			State:     event.State,
+			Value:     event.Value,
+			Threshold: event.Threshold,
+			CreatedAt: utils.TimeToMillis(event.CreatedAt),
+		})
+	}
+	utils.SendResponse(w, http.StatusOK, "", resp)
+}
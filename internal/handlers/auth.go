@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/go-redis/redis/v8"
+	"heart-rate-server/internal/alert"
 	"heart-rate-server/internal/config"
+	"heart-rate-server/internal/live"
 	"heart-rate-server/internal/middleware"
 	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/storage"
 	"heart-rate-server/internal/utils"
+	"heart-rate-server/internal/web"
+	"heart-rate-server/internal/webhook"
 	"net/http"
 	"time"
 
@@ -19,9 +24,20 @@ import (
 
 type App struct {
 	DB           *gorm.DB
-	Redis        *redis.Client
+	Redis        redis.UniversalClient
 	Config       *config.Config
 	SecureCookie *middleware.SecureCookie
+	Store        *storage.HeartRateStore
+	Live         *live.Hub
+	UUIDCache    *middleware.UUIDCacheMiddleware
+	ShareLinks   *middleware.ShareLinkMiddleware
+	SignedLinks  *middleware.SignedWidgetMiddleware
+	Devices      *middleware.DeviceAuthMiddleware
+	Alerts       *alert.Engine
+	Webhooks     *webhook.Dispatcher
+	Archive      *storage.SampleArchive
+	Replays      *storage.ReplayStore
+	Templates    *web.Templates
 }
 
 var validate = validator.New()
@@ -132,6 +148,7 @@ func (app *App) GetUUIDHandler(w http.ResponseWriter, r *http.Request) {
 	result := app.DB.First(&user, authInfo.UserID)
 	if result.Error != nil {
 		utils.SendError(w, http.StatusInternalServerError, result.Error, "Database error")
+		return
 	}
 
 	utils.SendResponse(w, http.StatusOK, "", map[string]string{"uuid": user.UUID})
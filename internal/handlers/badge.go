@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	badgeDefaultLabel = "heart rate"
+	badgeMaxLabel     = 32
+	// badgeCacheControl 徽章会被 GitHub 等代理缓存，只允许缓存很短的时间
+	badgeCacheControl = "public, max-age=5, s-maxage=5"
+)
+
+// 徽章颜色：离线、过期，以及在线时按心率区间着色
+const (
+	badgeColorOffline = "#9f9f9f"
+	badgeColorStale   = "#dfb317"
+	badgeColorLabel   = "#555"
+)
+
+// badgeZoneColors 静息及第1至5心率区间的颜色
+var badgeZoneColors = []string{"#4c1", "#4c1", "#97ca00", "#fe7d37", "#e05d44", "#b60205"}
+
+// badgeStyles 支持的徽章样式，与 shields.io 的同名样式外观一致
+var badgeStyles = map[string]bool{"flat": true, "flat-square": true, "for-the-badge": true}
+
+type badgeData struct {
+	Label, Value          string
+	Color, LabelColor     string
+	Width, Height         int
+	LabelWidth            int
+	ValueWidth            int
+	LabelX, ValueX, TextY int
+	FontSize              int
+	FontWeight            string
+	Rounded, Gradient     bool
+}
+
+var badgeTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" role="img" aria-label="{{.Label}}: {{.Value}}">
+<title>{{.Label}}: {{.Value}}</title>
+{{- if .Gradient}}
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+{{- end}}
+<clipPath id="r"><rect width="{{.Width}}" height="{{.Height}}" rx="{{if .Rounded}}3{{else}}0{{end}}" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="{{.LabelWidth}}" height="{{.Height}}" fill="{{.LabelColor}}"/>
+<rect x="{{.LabelWidth}}" width="{{.ValueWidth}}" height="{{.Height}}" fill="{{.Color}}"/>
+{{- if .Gradient}}
+<rect width="{{.Width}}" height="{{.Height}}" fill="url(#s)"/>
+{{- end}}
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="{{.FontSize}}" font-weight="{{.FontWeight}}">
+<text x="{{.LabelX}}" y="{{.TextY}}">{{.Label}}</text>
+<text x="{{.ValueX}}" y="{{.TextY}}">{{.Value}}</text>
+</g>
+</svg>
+`))
+
+// textWidth 估算文本在 Verdana 11px 下的宽度，只用于确定徽章尺寸
+func textWidth(text string) int {
+	width := 0.0
+	for _, r := range text {
+		switch {
+		case r > unicode.MaxLatin1:
+			width += 11
+		case r == ' ' || r == 'i' || r == 'l' || r == 'j' || r == '.' || r == ':':
+			width += 3.5
+		case unicode.IsUpper(r) || r == 'm' || r == 'w':
+			width += 8.5
+		default:
+			width += 6.8
+		}
+	}
+	return int(width + 0.5)
+}
+
+func badgeColor(resp *models.HeartRateDataResponse) string {
+	switch {
+	case resp == nil || resp.Status == models.HeartRateStatusOffline:
+		return badgeColorOffline
+	case resp.Status == models.HeartRateStatusStale:
+		return badgeColorStale
+	}
+	return badgeZoneColors[min(resp.ZoneIndex, len(badgeZoneColors)-1)]
+}
+
+// newBadge 计算徽章布局，for-the-badge 样式使用大写粗体和更大的边距
+func newBadge(style, label, value, color string) badgeData {
+	b := badgeData{
+		Label:      label,
+		Value:      value,
+		Color:      color,
+		LabelColor: badgeColorLabel,
+		Height:     20,
+		TextY:      14,
+		FontSize:   11,
+		FontWeight: "normal",
+		Rounded:    style == "flat",
+		Gradient:   style == "flat",
+	}
+
+	padding := 10
+	if style == "for-the-badge" {
+		b.Label, b.Value = strings.ToUpper(label), strings.ToUpper(value)
+		b.Height, b.TextY, b.FontSize, b.FontWeight = 28, 18, 10, "bold"
+		padding = 24
+	}
+
+	// 空标签时只显示数值
+	if b.Label != "" {
+		b.LabelWidth = textWidth(b.Label) + padding
+	}
+	b.ValueWidth = textWidth(b.Value) + padding
+	b.Width = b.LabelWidth + b.ValueWidth
+	b.LabelX = b.LabelWidth / 2
+	b.ValueX = b.LabelWidth + b.ValueWidth/2
+	return b
+}
+
+// PublicHeartRateBadgeHandler 以SVG徽章展示当前心率，用于无法运行脚本的场景（README、论坛签名、OBS图片源）。
+// 支持 ?label= 和 ?style=flat|flat-square|for-the-badge
+func (app *App) PublicHeartRateBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+
+	query := r.URL.Query()
+	label := badgeDefaultLabel
+	if _, ok := query["label"]; ok {
+		label = query.Get("label")
+	}
+	if utf8.RuneCountInString(label) > badgeMaxLabel {
+		utils.SendError(w, http.StatusBadRequest, fmt.Errorf("label must be at most %d characters", badgeMaxLabel), "Invalid badge options")
+		return
+	}
+	style := query.Get("style")
+	if style == "" {
+		style = "flat"
+	}
+	if !badgeStyles[style] {
+		utils.SendError(w, http.StatusBadRequest, fmt.Errorf("unsupported style: %q", style), "Invalid badge options")
+		return
+	}
+
+	policy, err := app.loadPublicPolicy(r.Context(), userID)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to load privacy settings")
+		return
+	}
+
+	// 没有数据或不允许公开查看时显示离线/私密，而不是返回错误，避免嵌入处显示破图
+	var resp *models.HeartRateDataResponse
+	visible := policy.visibleAt(time.Now())
+	if data, now, err := app.latestSample(r.Context(), userID, 0); err == nil && visible {
+		latest := app.newHeartRateResponse(r.Context(), userID, *data, now)
+		policy.apply(&latest)
+		resp = &latest
+	}
+
+	value := "offline"
+	switch {
+	case !visible:
+		value = "private"
+	case resp == nil || resp.Status == models.HeartRateStatusOffline:
+	case resp.ZoneName != "" && resp.HeartRate == 0:
+		value = resp.ZoneName
+	default:
+		value = strconv.Itoa(resp.HeartRate) + " bpm"
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", badgeCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if err := badgeTemplate.Execute(w, newBadge(style, label, value, badgeColor(resp))); err != nil {
+		return
+	}
+}
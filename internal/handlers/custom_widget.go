@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/sanitize"
+	"heart-rate-server/internal/utils"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	customWidgetStyle    = "custom"
+	customWidgetTemplate = "templates/widgets/custom.html"
+
+	customWidgetMaxHTML = 32 << 10
+	customWidgetMaxCSS  = 16 << 10
+	// 请求体上限，包含JSON或表单编码的开销
+	customWidgetMaxBody = 128 << 10
+)
+
+// customWidgetCSP 自定义组件的内容安全策略：只允许本站脚本，
+// 禁止内联脚本、外部图片和表单，用户标记即使绕过清理也无法执行脚本
+const customWidgetCSP = "default-src 'none'; " +
+	"script-src 'self'; " +
+	"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; " +
+	"font-src https://fonts.gstatic.com data:; " +
+	"img-src 'self' data:; " +
+	"connect-src 'self'; " +
+	"base-uri 'none'; form-action 'none'"
+
+// decodeCustomWidgetRequest 支持JSON和表单两种请求体，表单用于账户页预览
+func decodeCustomWidgetRequest(w http.ResponseWriter, r *http.Request) (models.CustomWidgetRequest, error) {
+	var req models.CustomWidgetRequest
+	r.Body = http.MaxBytesReader(w, r.Body, customWidgetMaxBody)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			return req, err
+		}
+		req.HTML = r.PostForm.Get("html")
+		req.CSS = r.PostForm.Get("css")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, err
+	}
+
+	if len(req.HTML) > customWidgetMaxHTML {
+		return req, fmt.Errorf("html must be at most %d bytes", customWidgetMaxHTML)
+	}
+	if len(req.CSS) > customWidgetMaxCSS {
+		return req, fmt.Errorf("css must be at most %d bytes", customWidgetMaxCSS)
+	}
+	return req, nil
+}
+
+// widgetSource 自定义组件的数据来源，通过 body 的 data-* 属性传给前端脚本
+type widgetSource struct {
+	DataBase string
+	Delay    int
+	Replay   *replayOptions
+}
+
+// renderCustomWidget 清理用户模板后渲染，并附带严格的CSP
+func (app *App) renderCustomWidget(w http.ResponseWriter, source widgetSource, rawHTML, rawCSS string) {
+	markup, err := sanitize.HTML(rawHTML)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid widget markup")
+		return
+	}
+
+	tmpl, err := app.Templates.Get(customWidgetTemplate)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to load template")
+		return
+	}
+
+	replay := ""
+	if source.Replay != nil {
+		encoded, err := json.Marshal(source.Replay)
+		if err != nil {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to encode replay options")
+			return
+		}
+		replay = string(encoded)
+	}
+
+	w.Header().Set("Content-Security-Policy", customWidgetCSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, map[string]interface{}{
+		"DataBase": source.DataBase,
+		"Delay":    source.Delay,
+		"Replay":   replay,
+		"Markup":   template.HTML(markup),
+		"CSS":      template.CSS(sanitize.CSS(rawCSS)),
+	}); err != nil {
+		log.Printf("Failed to render custom widget: %v", err)
+	}
+}
+
+// publicCustomWidget 渲染用户保存的自定义组件
+func (app *App) publicCustomWidget(w http.ResponseWriter, userID uint, source widgetSource) {
+	var widget models.CustomWidget
+	if err := app.DB.Where("user_id = ?", userID).First(&widget).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendError(w, http.StatusNotFound, nil, "Custom widget not found")
+		} else {
+			utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		}
+		return
+	}
+	app.renderCustomWidget(w, source, widget.HTML, widget.CSS)
+}
+
+// GetCustomWidgetHandler 获取当前用户保存的自定义组件原始内容
+func (app *App) GetCustomWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var widget models.CustomWidget
+	if err := app.DB.Where("user_id = ?", authInfo.UserID).First(&widget).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendError(w, http.StatusNotFound, nil, "Custom widget not found")
+		} else {
+			utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		}
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, "", models.CustomWidgetRequest{HTML: widget.HTML, CSS: widget.CSS})
+}
+
+// SaveCustomWidgetHandler 保存自定义组件，每个用户一份
+func (app *App) SaveCustomWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	req, err := decodeCustomWidgetRequest(w, r)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if _, err := sanitize.HTML(req.HTML); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid widget markup")
+		return
+	}
+
+	var widget models.CustomWidget
+	err = app.DB.Where("user_id = ?", authInfo.UserID).First(&widget).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		widget = models.CustomWidget{UserID: authInfo.UserID, HTML: req.HTML, CSS: req.CSS}
+		err = app.DB.Create(&widget).Error
+	case err == nil:
+		widget.HTML = req.HTML
+		widget.CSS = req.CSS
+		err = app.DB.Save(&widget).Error
+	}
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to save custom widget")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, "Custom widget saved", nil)
+}
+
+// DeleteCustomWidgetHandler 删除自定义组件
+func (app *App) DeleteCustomWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	result := app.DB.Unscoped().Where("user_id = ?", authInfo.UserID).Delete(&models.CustomWidget{})
+	if result.Error != nil {
+		utils.SendError(w, http.StatusInternalServerError, result.Error, "Failed to delete custom widget")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.SendError(w, http.StatusNotFound, nil, "Custom widget not found")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, "Custom widget deleted", nil)
+}
+
+// PreviewCustomWidgetHandler 不保存，直接以当前用户的数据渲染提交的模板
+func (app *App) PreviewCustomWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	req, err := decodeCustomWidgetRequest(w, r)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	var user models.User
+	if err := app.DB.First(&user, authInfo.UserID).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	app.renderCustomWidget(w, widgetSource{DataBase: "/uuid/" + user.UUID}, req.HTML, req.CSS)
+}
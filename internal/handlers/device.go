@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"heart-rate-server/internal/middleware"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxDevices 每个用户最多登记的设备数
+	maxDevices = 20
+
+	// deviceRankCacheTTL 设备优先级在本实例缓存的时间
+	deviceRankCacheTTL = 5 * time.Second
+)
+
+// deviceRanks 用户各设备的优先级（设备ID -> Priority），选择最新样本时每次都要读取
+var deviceRanks = newTTLCache[uint, map[uint]int](deviceRankCacheTTL, 10000)
+
+func newDeviceResponse(device models.Device) models.DeviceResponse {
+	resp := models.DeviceResponse{
+		ID:        device.ID,
+		Name:      device.Name,
+		Type:      device.Type,
+		Priority:  device.Priority,
+		Firmware:  device.Firmware,
+		Battery:   device.Battery,
+		CreatedAt: utils.TimeToMillis(device.CreatedAt),
+	}
+	if device.LastSeenAt != nil {
+		resp.LastSeenAt = utils.TimeToMillis(*device.LastSeenAt)
+	}
+	return resp
+}
+
+func (app *App) loadDeviceRanks(ctx context.Context, userID uint) (map[uint]int, error) {
+	if ranks, ok := deviceRanks.get(userID); ok {
+		return ranks, nil
+	}
+
+	var devices []models.Device
+	if err := app.DB.WithContext(ctx).Select("id", "priority").Where("user_id = ?", userID).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	ranks := make(map[uint]int, len(devices))
+	for _, device := range devices {
+		ranks[device.ID] = device.Priority
+	}
+	deviceRanks.set(userID, ranks)
+	return ranks, nil
+}
+
+// deviceRank 未登记设备（包括通过账户或UUID上报的样本）优先级最低
+func deviceRank(ranks map[uint]int, deviceID uint) int {
+	if rank, ok := ranks[deviceID]; ok {
+		return rank
+	}
+	return math.MaxInt
+}
+
+// preferSample 判断按时间顺序到达的 candidate 是否取代当前显示的 current：
+// 同一设备的新样本总是取代；不同设备时，current 已超出并发窗口或 candidate 优先级不低于 current 才取代
+func (app *App) preferSample(ranks map[uint]int, current *models.HeartRateData, candidate models.HeartRateData) bool {
+	if current == nil {
+		return true
+	}
+	if candidate.MeasuredAt < current.MeasuredAt {
+		return false
+	}
+	if candidate.DeviceID == current.DeviceID {
+		return true
+	}
+	window := int64(app.Config.StaleAfter / time.Millisecond)
+	if candidate.MeasuredAt-current.MeasuredAt >= window {
+		return true
+	}
+	return deviceRank(ranks, candidate.DeviceID) <= deviceRank(ranks, current.DeviceID)
+}
+
+// PreferredSamples 按 preferSample 依次筛选按时间排序的样本，结果与实时推送显示的样本一致。
+// 读取设备优先级失败时返回全部样本
+func (app *App) PreferredSamples(ctx context.Context, userID uint, samples []models.HeartRateData) []models.HeartRateData {
+	ranks, err := app.loadDeviceRanks(ctx, userID)
+	if err != nil || len(ranks) == 0 {
+		return samples
+	}
+
+	preferred := make([]models.HeartRateData, 0, len(samples))
+	var last *models.HeartRateData
+	for i := range samples {
+		if app.preferSample(ranks, last, samples[i]) {
+			preferred = append(preferred, samples[i])
+			last = &samples[i]
+		}
+	}
+	return preferred
+}
+
+// preferDevice 多个设备同时上报时，在 at 之前的并发窗口内按设备优先级选择样本
+func (app *App) preferDevice(ctx context.Context, userID uint, latest *models.HeartRateData, at int64) *models.HeartRateData {
+	ranks, err := app.loadDeviceRanks(ctx, userID)
+	if err != nil || len(ranks) == 0 {
+		return latest
+	}
+
+	window := int64(app.Config.StaleAfter / time.Millisecond)
+	samples, err := app.Store.Range(ctx, userID, at-window, at)
+	if err != nil {
+		return latest
+	}
+	var selected *models.HeartRateData
+	for i := range samples {
+		if app.preferSample(ranks, selected, samples[i]) {
+			selected = &samples[i]
+		}
+	}
+	if selected == nil {
+		return latest
+	}
+	return selected
+}
+
+// ListDevicesHandler 列出当前用户的设备
+func (app *App) ListDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var devices []models.Device
+	if err := app.DB.Where("user_id = ?", authInfo.UserID).Order("priority, id").Find(&devices).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	resp := make([]models.DeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		resp = append(resp, newDeviceResponse(device))
+	}
+	utils.SendResponse(w, http.StatusOK, "", resp)
+}
+
+// CreateDeviceHandler 登记设备并生成上报令牌，令牌只在创建时返回一次
+func (app *App) CreateDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var req models.CreateDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	var count int64
+	if err := app.DB.Model(&models.Device{}).Where("user_id = ?", authInfo.UserID).Count(&count).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+	if count >= maxDevices {
+		utils.SendError(w, http.StatusConflict, nil, "Too many devices")
+		return
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to generate token")
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	device := models.Device{
+		UserID:    authInfo.UserID,
+		Name:      req.Name,
+		Type:      req.Type,
+		TokenHash: middleware.HashDeviceToken(token),
+		Priority:  req.Priority,
+	}
+	if err := app.DB.Create(&device).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to create device")
+		return
+	}
+	deviceRanks.delete(authInfo.UserID)
+
+	resp := newDeviceResponse(device)
+	resp.Token = token
+	utils.SendResponse(w, http.StatusCreated, "Device created", resp)
+}
+
+// UpdateDeviceHandler 修改设备名称和优先级
+func (app *App) UpdateDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	device, ok := app.findDevice(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	device.Name = req.Name
+	device.Priority = req.Priority
+	if err := app.DB.Model(&device).Select("name", "priority").Updates(&device).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to update device")
+		return
+	}
+	deviceRanks.delete(authInfo.UserID)
+
+	utils.SendResponse(w, http.StatusOK, "Device updated", newDeviceResponse(device))
+}
+
+// DeleteDeviceHandler 删除设备，其令牌在所有实例上立即失效，已上报的样本保留
+func (app *App) DeleteDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	device, ok := app.findDevice(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+	if err := app.DB.Unscoped().Delete(&device).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to delete device")
+		return
+	}
+	deviceRanks.delete(authInfo.UserID)
+
+	if err := app.Devices.Invalidate(r.Context(), device.TokenHash); err != nil {
+		log.Printf("Failed to broadcast device deletion: %v", err)
+	}
+	utils.SendResponse(w, http.StatusOK, "Device deleted", nil)
+}
+
+func (app *App) findDevice(w http.ResponseWriter, r *http.Request, userID uint) (models.Device, bool) {
+	var device models.Device
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid device ID")
+		return device, false
+	}
+	if err := app.DB.Where("id = ? AND user_id = ?", id, userID).First(&device).Error; err != nil {
+		utils.SendError(w, http.StatusNotFound, nil, "Device not found")
+		return device, false
+	}
+	return device, true
+}
+
+// DeviceReportDataHandler 设备使用自己的令牌上报心率，样本标记为该设备，
+// 可附带固件版本和电量
+func (app *App) DeviceReportDataHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := ctx.Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+	deviceID, _ := ctx.Value("device_id").(uint)
+
+	var req models.DeviceReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	measuredTime := utils.MillisToTime(req.MeasuredAt)
+	now := time.Now()
+	if measuredTime.After(now.Add(5 * time.Minute)) {
+		utils.SendError(w, http.StatusBadRequest, nil, "Measurement time cannot be in the future")
+		return
+	}
+	if measuredTime.Before(now.Add(-10 * time.Minute)) {
+		utils.SendError(w, http.StatusBadRequest, nil, "Measurement time is too old")
+		return
+	}
+
+	data := req.HeartRateData
+	data.DeviceID = deviceID
+	if err := app.acceptSample(ctx, userID, data, 10*time.Minute); err != nil {
+		utils.SendError(w, http.StatusServiceUnavailable, err, "Failed to store data")
+		return
+	}
+
+	// 样本中的电量同样记录为设备电量
+	var meta models.DeviceMetadata
+	if req.Device != nil {
+		meta = *req.Device
+	}
+	if meta.Battery == nil {
+		meta.Battery = data.Data.Battery
+	}
+	if hash, ok := ctx.Value("device_token_hash").(string); ok {
+		if err := app.Devices.Touch(ctx, hash, &meta); err != nil {
+			log.Printf("Failed to update device %d: %v", deviceID, err)
+		}
+	}
+
+	utils.SendResponse(w, http.StatusOK, "OK", nil)
+}
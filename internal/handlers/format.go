@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// writeLatest 以协商的格式写出最新心率，纯文本只包含心率数值（区间模式下为区间名称），便于OBS文本源和脚本读取
+func writeLatest(w http.ResponseWriter, format string, resp models.HeartRateDataResponse) {
+	switch format {
+	case utils.FormatText:
+		w.Header().Set("Content-Type", utils.ContentType(format))
+		w.WriteHeader(http.StatusOK)
+		// 隐私设置为区间模式时心率为0，与徽章一样输出区间名称
+		var value interface{} = resp.HeartRate
+		if resp.ZoneName != "" && resp.HeartRate == 0 {
+			value = resp.ZoneName
+		}
+		if _, err := fmt.Fprintln(w, value); err != nil {
+			return
+		}
+	case utils.FormatCSV:
+		header := append([]string{"heart_rate", "measured_at", "age_ms", "status", "zone_index", "zone_name"}, extrasHeader...)
+		writeCSV(w, header, [][]string{append([]string{
+			strconv.Itoa(resp.HeartRate),
+			strconv.FormatInt(resp.MeasuredAt, 10),
+			strconv.FormatInt(resp.AgeMs, 10),
+			resp.Status,
+			strconv.Itoa(resp.ZoneIndex),
+			resp.ZoneName,
+		}, extrasColumns(resp.SampleExtras)...)})
+	case utils.FormatMsgpack:
+		utils.SendMsgpack(w, http.StatusOK, "ok", resp)
+	default:
+		utils.SendResponse(w, http.StatusOK, "ok", resp)
+	}
+}
+
+// writeHistory 以协商的格式写出历史样本，纯文本每行一个心率值
+func writeHistory(w http.ResponseWriter, format string, resp models.HeartRateHistoryResponse) {
+	switch format {
+	case utils.FormatText:
+		w.Header().Set("Content-Type", utils.ContentType(format))
+		w.WriteHeader(http.StatusOK)
+		for _, sample := range resp.Samples {
+			if _, err := fmt.Fprintln(w, sample.HeartRate); err != nil {
+				return
+			}
+		}
+	case utils.FormatCSV:
+		rows := make([][]string, 0, len(resp.Samples))
+		for _, sample := range resp.Samples {
+			row := []string{strconv.FormatInt(sample.MeasuredAt, 10), strconv.Itoa(sample.HeartRate)}
+			rows = append(rows, append(row, extrasColumns(sample.SampleExtras)...))
+		}
+		writeCSV(w, append([]string{"measured_at", "heart_rate"}, extrasHeader...), rows)
+	case utils.FormatMsgpack:
+		utils.SendMsgpack(w, http.StatusOK, "ok", resp)
+	default:
+		utils.SendResponse(w, http.StatusOK, "ok", resp)
+	}
+}
+
+// extrasHeader 附加数据在CSV中的列，追加在原有列之后，未上报的值为空
+var extrasHeader = []string{"spo2", "battery", "sensor_contact", "energy_expended", "rr_intervals"}
+
+// extrasColumns 按 extrasHeader 的顺序输出附加数据，逐搏间期以空格分隔
+func extrasColumns(extras models.SampleExtras) []string {
+	optional := func(v *int) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	}
+	contact := ""
+	if extras.SensorContact != nil {
+		contact = strconv.FormatBool(*extras.SensorContact)
+	}
+	rr := make([]string, len(extras.RRIntervals))
+	for i, v := range extras.RRIntervals {
+		rr[i] = strconv.Itoa(v)
+	}
+	return []string{
+		optional(extras.SpO2),
+		optional(extras.Battery),
+		contact,
+		optional(extras.EnergyExpended),
+		strings.Join(rr, " "),
+	}
+}
+
+func writeCSV(w http.ResponseWriter, header []string, rows [][]string) {
+	w.Header().Set("Content-Type", utils.ContentType(utils.FormatCSV))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return
+	}
+}
@@ -2,12 +2,25 @@ package handlers
 
 import (
 	"heart-rate-server/internal/utils"
-	"html/template"
 	"net/http"
 )
 
-func HealthHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("templates/auth.html")
+const (
+	authTemplate  = "templates/auth.html"
+	indexTemplate = "templates/index.html"
+)
+
+// TemplateSets 所有页面使用的模板文件组，启动时预先解析
+func TemplateSets() [][]string {
+	sets := [][]string{{authTemplate}, {indexTemplate}, {customWidgetTemplate}}
+	for _, style := range widgetStyles {
+		sets = append(sets, style.Files)
+	}
+	return sets
+}
+
+func (app *App) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := app.Templates.Get(authTemplate)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -20,7 +33,7 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *App) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("templates/index.html")
+	tmpl, err := app.Templates.Get(indexTemplate)
 	if err != nil {
 		utils.SendError(w, http.StatusInternalServerError, err, "Failed to load template")
 		return
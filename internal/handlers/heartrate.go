@@ -1,21 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gorilla/mux"
 	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/storage"
 	"heart-rate-server/internal/utils"
-	"html/template"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
-
-	"github.com/go-redis/redis/v8"
 )
 
 func (app *App) ReceiveDataHandler(w http.ResponseWriter, r *http.Request) {
 	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
-	userID := fmt.Sprintf("%d", authInfo.UserID)
 
 	var data models.HeartRateData
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
@@ -27,6 +28,7 @@ func (app *App) ReceiveDataHandler(w http.ResponseWriter, r *http.Request) {
 		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
 		return
 	}
+	data.DeviceID = 0
 
 	measuredTime := time.Unix(0, data.MeasuredAt*int64(time.Millisecond))
 	now := time.Now()
@@ -42,26 +44,8 @@ func (app *App) ReceiveDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to process data")
-		return
-	}
-
-	ctx := r.Context()
-	key := fmt.Sprintf("heart_rate:%s", userID)
-	z := &redis.Z{
-		Score:  float64(data.MeasuredAt),
-		Member: jsonData,
-	}
-
-	// Use pipeline for atomic operations
-	pipe := app.Redis.TxPipeline()
-	pipe.ZAdd(ctx, key, z)
-	pipe.Expire(ctx, key, 10*time.Minute)
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to store data")
+	if err := app.acceptSample(r.Context(), authInfo.UserID, data, 10*time.Minute); err != nil {
+		utils.SendError(w, http.StatusServiceUnavailable, err, "Failed to store data")
 		return
 	}
 
@@ -70,44 +54,7 @@ func (app *App) ReceiveDataHandler(w http.ResponseWriter, r *http.Request) {
 
 func (app *App) LatestHeartRateHandler(w http.ResponseWriter, r *http.Request) {
 	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
-	userID := fmt.Sprintf("%d", authInfo.UserID)
-	ctx := r.Context()
-	key := fmt.Sprintf("heart_rate:%s", userID)
-
-	// Check if key exists
-	exists, err := app.Redis.Exists(ctx, key).Result()
-	if err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to check data existence")
-		return
-	}
-	if exists == 0 {
-		utils.SendError(w, http.StatusNotFound, nil, "No heart rate data found")
-		return
-	}
-
-	// Get latest data
-	result, err := app.Redis.ZRevRangeWithScores(ctx, key, 0, 0).Result()
-	if err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to retrieve data")
-		return
-	}
-
-	if len(result) == 0 {
-		utils.SendError(w, http.StatusNotFound, nil, "No heart rate data found")
-		return
-	}
-
-	var storedData models.HeartRateData
-	if err := json.Unmarshal([]byte(result[0].Member.(string)), &storedData); err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to parse data")
-		return
-	}
-	var resultData models.HeartRateDataResponse
-	resultData.HeartRate = storedData.Data.HeartRate
-	resultData.MeasuredAt = storedData.MeasuredAt
-
-	// 返回JSON数据
-	utils.SendResponse(w, http.StatusOK, "ok", resultData)
+	app.sendLatest(w, r, authInfo.UserID, nil)
 }
 
 // UUIDReportDataHandler 通过UUID上报心率数据
@@ -131,6 +78,11 @@ func (app *App) UUIDReportDataHandler(w http.ResponseWriter, r *http.Request) {
 		utils.SendError(w, http.StatusBadRequest, nil, "Heart rate must be between 1-250")
 		return
 	}
+	if err := validate.Struct(data.Data.SampleExtras); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	data.DeviceID = 0
 
 	// 处理时间戳
 	measuredTime := time.Unix(0, data.MeasuredAt*int64(time.Millisecond))
@@ -141,25 +93,9 @@ func (app *App) UUIDReportDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 存储到Redis
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to process data")
-		return
-	}
-
-	ctx := r.Context()
-	key := fmt.Sprintf("heart_rate:%d", userID)
-	z := &redis.Z{
-		Score:  float64(data.MeasuredAt),
-		Member: jsonData,
-	}
-
-	pipe := app.Redis.TxPipeline()
-	pipe.ZAdd(ctx, key, z)
-	pipe.Expire(ctx, key, 30*time.Minute) // 设置较短的过期时间
-	if _, err := pipe.Exec(ctx); err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to store data")
+	// 存储到Redis，设置较短的过期时间
+	if err := app.acceptSample(r.Context(), userID, data, 30*time.Minute); err != nil {
+		utils.SendError(w, http.StatusServiceUnavailable, err, "Failed to store data")
 		return
 	}
 
@@ -173,45 +109,237 @@ func (app *App) PublicHeartRateHandler(w http.ResponseWriter, r *http.Request) {
 		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
 		return
 	}
+	policy, ok := app.visiblePolicy(w, r, userID)
+	if !ok {
+		return
+	}
+	app.sendLatest(w, r, userID, policy)
+}
 
-	ctx := r.Context()
-	key := fmt.Sprintf("heart_rate:%d", userID)
+// sendLatest 按 Accept 或 ?format= 返回最新心率，policy 不为 nil 时按隐私设置降低精度
+func (app *App) sendLatest(w http.ResponseWriter, r *http.Request, userID uint, policy *publicPolicy) {
+	w.Header().Add("Vary", "Accept")
+	format, err := utils.NegotiateFormat(r)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid format")
+		return
+	}
 
-	result, err := app.Redis.ZRevRangeWithScores(ctx, key, 0, 0).Result()
-	if err != nil || len(result) == 0 {
-		utils.SendError(w, http.StatusNotFound, nil, "No heart rate data available")
+	delay, err := app.parseDelay(r)
+	if err != nil {
+		utils.SendFormattedError(w, format, http.StatusBadRequest, err, "Invalid delay")
 		return
 	}
 
-	var data models.HeartRateData
-	if err := json.Unmarshal([]byte(result[0].Member.(string)), &data); err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to parse data")
+	data, now, err := app.latestSample(r.Context(), userID, delay)
+	if err != nil {
+		if errors.Is(err, storage.ErrNoData) {
+			utils.SendFormattedError(w, format, http.StatusNotFound, nil, "No heart rate data found")
+		} else {
+			utils.SendFormattedError(w, format, http.StatusInternalServerError, err, "Failed to retrieve data")
+		}
 		return
 	}
-	var resultData models.HeartRateDataResponse
-	resultData.HeartRate = data.Data.HeartRate
-	resultData.MeasuredAt = data.MeasuredAt
 
-	// 返回JSON数据
-	utils.SendResponse(w, http.StatusOK, "ok", resultData)
+	resp := app.newHeartRateResponse(r.Context(), userID, *data, now)
+	if policy == nil || policy.Mode == models.PrivacyModeExact {
+		app.attachHRV(r.Context(), userID, &resp, data.MeasuredAt)
+	}
+	if policy != nil {
+		policy.apply(&resp)
+	}
+	writeLatest(w, format, resp)
 }
 
-func (app *App) PublicHeartRateHTMLHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	uuid := vars["uuid"]
+// acceptSample 保存通过校验的样本，推送给所有实例上的实时观看者，检查告警规则并发布Webhook事件
+func (app *App) acceptSample(ctx context.Context, userID uint, data models.HeartRateData, ttl time.Duration) error {
+	if err := app.Store.Save(ctx, userID, data, ttl); err != nil {
+		return err
+	}
+	app.Archive.Add(userID, data)
+	app.Alerts.Evaluate(ctx, userID, data)
+	app.Webhooks.PublishSample(ctx, userID, data)
 
-	// 使用Go模板渲染HTML
-	tmpl, err := template.ParseFiles("templates/default.html")
+	// 推送失败不影响上报结果，Hub 会退回到本实例内投递
+	if err := app.Live.Publish(ctx, userID, data); err != nil && !errors.Is(err, storage.ErrCircuitOpen) {
+		log.Printf("Failed to publish live heart rate for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// maxStreamDelay 直播延迟的上限，同时不能超过历史样本窗口
+const maxStreamDelay = 5 * time.Minute
+
+// parseDelay 解析 ?delay=（秒），用于与有延迟的直播画面对齐
+func (app *App) parseDelay(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("delay")
+	if value == "" {
+		return 0, nil
+	}
+	limit := app.maxDelay()
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > limit {
+		return 0, fmt.Errorf("delay must be between 0-%d seconds", int(limit/time.Second))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (app *App) maxDelay() time.Duration {
+	if app.Config.HistoryWindow < maxStreamDelay {
+		return app.Config.HistoryWindow
+	}
+	return maxStreamDelay
+}
+
+// latestSample 返回 delay 之前的最新样本，以及计算数据年龄时使用的参考时间（毫秒）。
+// 多个设备同时上报时按设备优先级选择
+func (app *App) latestSample(ctx context.Context, userID uint, delay time.Duration) (*models.HeartRateData, int64, error) {
+	now := utils.CurrentMillis()
+	if delay == 0 {
+		data, err := app.Store.Latest(ctx, userID)
+		if err != nil {
+			return nil, now, err
+		}
+		return app.preferDevice(ctx, userID, data, now), now, nil
+	}
+
+	at := now - int64(delay/time.Millisecond)
+	data, err := app.Store.LatestBefore(ctx, userID, at)
+	if err != nil {
+		return nil, at, err
+	}
+	return app.preferDevice(ctx, userID, data, at), at, nil
+}
+
+// newHeartRateResponse 构造响应，根据数据相对 now（毫秒）的年龄计算在线状态，
+// 并按用户的心率区间标注区间
+func (app *App) newHeartRateResponse(ctx context.Context, userID uint, data models.HeartRateData, now int64) models.HeartRateDataResponse {
+	ageMs := now - data.MeasuredAt
+	if ageMs < 0 {
+		ageMs = 0
+	}
+
+	status := models.HeartRateStatusLive
+	age := time.Duration(ageMs) * time.Millisecond
+	switch {
+	case age >= app.Config.OfflineAfter:
+		status = models.HeartRateStatusOffline
+	case age >= app.Config.StaleAfter:
+		status = models.HeartRateStatusStale
+	}
+
+	zoneIndex, zoneName := app.loadZoneTable(ctx, userID).classify(data.Data.HeartRate)
+	return models.HeartRateDataResponse{
+		HeartRate:    data.Data.HeartRate,
+		MeasuredAt:   data.MeasuredAt,
+		AgeMs:        ageMs,
+		Status:       status,
+		ZoneIndex:    zoneIndex,
+		ZoneName:     zoneName,
+		DeviceID:     data.DeviceID,
+		SampleExtras: data.Data.SampleExtras,
+	}
+}
+
+// HeartRateHistoryHandler 获取当前用户最近 N 分钟的心率
+func (app *App) HeartRateHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+	app.sendHistory(w, r, authInfo.UserID, nil)
+}
+
+// PublicHeartRateHistoryHandler 通过UUID获取最近 N 分钟的心率
+func (app *App) PublicHeartRateHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+	policy, ok := app.visiblePolicy(w, r, userID)
+	if !ok {
+		return
+	}
+	app.sendHistory(w, r, userID, policy)
+}
+
+// parseHistoryMinutes 解析 ?minutes=，默认5分钟，不超过保留窗口
+func (app *App) parseHistoryMinutes(value string) (int, error) {
+	maxMinutes := int(app.Config.HistoryWindow / time.Minute)
+	if value == "" {
+		if maxMinutes < 5 {
+			return maxMinutes, nil
+		}
+		return 5, nil
+	}
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes < 1 || minutes > maxMinutes {
+		return 0, fmt.Errorf("minutes must be between 1-%d", maxMinutes)
+	}
+	return minutes, nil
+}
+
+func (app *App) sendHistory(w http.ResponseWriter, r *http.Request, userID uint, policy *publicPolicy) {
+	w.Header().Add("Vary", "Accept")
+	format, err := utils.NegotiateFormat(r)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid format")
+		return
+	}
+
+	minutes, err := app.parseHistoryMinutes(r.URL.Query().Get("minutes"))
 	if err != nil {
-		utils.SendError(w, http.StatusInternalServerError, err, "Failed to load template")
+		utils.SendFormattedError(w, format, http.StatusBadRequest, err, "Invalid minutes")
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html")
-	err2 := tmpl.Execute(w, map[string]interface{}{
-		"UUID": uuid,
-	})
-	if err2 != nil {
+	delay, err := app.parseDelay(r)
+	if err != nil {
+		utils.SendFormattedError(w, format, http.StatusBadRequest, err, "Invalid delay")
 		return
 	}
+
+	to := utils.CurrentMillis() - int64(delay/time.Millisecond)
+	from := to - int64(minutes)*int64(time.Minute/time.Millisecond)
+	samples, err := app.Store.Range(r.Context(), userID, from, to)
+	if err != nil {
+		utils.SendFormattedError(w, format, http.StatusInternalServerError, err, "Failed to retrieve data")
+		return
+	}
+	if policy != nil {
+		if samples, err = policy.applySamples(samples); err != nil {
+			utils.SendFormattedError(w, format, http.StatusForbidden, nil, "History is not public in zone mode")
+			return
+		}
+	}
+
+	writeHistory(w, format, newHistoryResponse(from, to, samples))
+}
+
+func newHistoryResponse(from, to int64, samples []models.HeartRateData) models.HeartRateHistoryResponse {
+	resp := models.HeartRateHistoryResponse{
+		From:    from,
+		To:      to,
+		Samples: make([]models.HeartRatePoint, 0, len(samples)),
+	}
+
+	sum := 0
+	for i, sample := range samples {
+		hr := sample.Data.HeartRate
+		if i == 0 || hr < resp.Min {
+			resp.Min = hr
+		}
+		if hr > resp.Max {
+			resp.Max = hr
+		}
+		sum += hr
+		resp.Samples = append(resp.Samples, models.HeartRatePoint{
+			HeartRate:    hr,
+			MeasuredAt:   sample.MeasuredAt,
+			DeviceID:     sample.DeviceID,
+			SampleExtras: sample.Data.SampleExtras,
+		})
+	}
+	if len(samples) > 0 {
+		resp.Avg = math.Round(float64(sum)/float64(len(samples))*10) / 10
+	}
+	return resp
 }
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"heart-rate-server/internal/hrv"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	hrvDefaultWindow = 5 * time.Minute
+	hrvMinWindow     = 30 * time.Second
+	// hrvLatestWindow 最新心率接口附带的心率变异性使用的窗口
+	hrvLatestWindow = time.Minute
+	// hrvMaxGap 相邻样本间隔超过该时间时认为中间缺失搏动，不计算跨越的逐搏差值
+	hrvMaxGap = 3 * time.Second
+	// hrvLatestCacheTTL 同一样本附带的心率变异性缓存的时间，推送的心跳和多个观看者共用
+	hrvLatestCacheTTL = 10 * time.Second
+)
+
+// errNotEnoughRR 窗口内的正常逐搏间期不足以计算指标
+var errNotEnoughRR = errors.New("not enough RR intervals")
+
+type hrvSampleKey struct {
+	userID     uint
+	measuredAt int64
+}
+
+// latestHRV 按样本缓存最新心率附带的心率变异性，间期不足时缓存 nil
+var latestHRV = newTTLCache[hrvSampleKey, *models.HRVMetrics](hrvLatestCacheTTL, 10000)
+
+// parseHRVWindow 解析 ?window=（秒），默认5分钟，不超过保留窗口
+func (app *App) parseHRVWindow(value string) (time.Duration, error) {
+	limit := app.Config.HistoryWindow
+	if value == "" {
+		return min(hrvDefaultWindow, limit), nil
+	}
+	seconds, err := strconv.Atoi(value)
+	window := time.Duration(seconds) * time.Second
+	if err != nil || window < hrvMinWindow || window > limit {
+		return 0, fmt.Errorf("window must be between %d-%d seconds", int(hrvMinWindow/time.Second), int(limit/time.Second))
+	}
+	return window, nil
+}
+
+// hrvSegments 选择提供逐搏间期的设备（优先级最高，相同时取样本多的，再相同时取ID较小的），
+// 按样本间隔把间期分成连续的序列。传感器未接触皮肤的样本被忽略
+func hrvSegments(ranks map[uint]int, samples []models.HeartRateData) (uint, [][]int) {
+	counts := make(map[uint]int)
+	for _, sample := range samples {
+		if len(sample.Data.RRIntervals) > 0 {
+			counts[sample.DeviceID]++
+		}
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+
+	var device uint
+	best := -1
+	for _, id := range slices.Sorted(maps.Keys(counts)) {
+		count := counts[id]
+		if best < 0 || deviceRank(ranks, id) < deviceRank(ranks, device) ||
+			(deviceRank(ranks, id) == deviceRank(ranks, device) && count > best) {
+			device, best = id, count
+		}
+	}
+
+	var segments [][]int
+	var last int64
+	gap := int64(hrvMaxGap / time.Millisecond)
+	for _, sample := range samples {
+		if sample.DeviceID != device || len(sample.Data.RRIntervals) == 0 {
+			continue
+		}
+		if contact := sample.Data.SensorContact; contact != nil && !*contact {
+			continue
+		}
+		if len(segments) == 0 || sample.MeasuredAt-last > gap {
+			segments = append(segments, nil)
+		}
+		segments[len(segments)-1] = append(segments[len(segments)-1], sample.Data.RRIntervals...)
+		last = sample.MeasuredAt
+	}
+	return device, segments
+}
+
+// computeHRV 计算 (to-window, to] 内的心率变异性
+func (app *App) computeHRV(ctx context.Context, userID uint, to int64, window time.Duration) (*models.HRVResponse, error) {
+	from := to - int64(window/time.Millisecond)
+	samples, err := app.Store.Range(ctx, userID, from+1, to)
+	if err != nil {
+		return nil, err
+	}
+	ranks, err := app.loadDeviceRanks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	device, segments := hrvSegments(ranks, samples)
+	metrics, ok := hrv.Compute(segments)
+	if !ok {
+		return nil, errNotEnoughRR
+	}
+	return &models.HRVResponse{
+		From:     from,
+		To:       to,
+		DeviceID: device,
+		HRVMetrics: models.HRVMetrics{
+			RMSSD:     metrics.RMSSD,
+			SDNN:      metrics.SDNN,
+			PNN50:     metrics.PNN50,
+			MeanRR:    metrics.MeanRR,
+			Beats:     metrics.Beats,
+			Artifacts: metrics.Artifacts,
+			WindowMs:  int64(window / time.Millisecond),
+		},
+	}, nil
+}
+
+// HRVHandler 当前用户最近一段时间的心率变异性
+func (app *App) HRVHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+	app.sendHRV(w, r, authInfo.UserID)
+}
+
+// PublicHRVHandler 公开的心率变异性，只在隐私设置为精确模式时提供
+func (app *App) PublicHRVHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+	policy, ok := app.visiblePolicy(w, r, userID)
+	if !ok {
+		return
+	}
+	if policy.Mode != models.PrivacyModeExact {
+		utils.SendError(w, http.StatusForbidden, nil, "HRV is only public in exact mode")
+		return
+	}
+	app.sendHRV(w, r, userID)
+}
+
+// sendHRV 支持 ?window=（秒）和 ?delay=
+func (app *App) sendHRV(w http.ResponseWriter, r *http.Request, userID uint) {
+	window, err := app.parseHRVWindow(r.URL.Query().Get("window"))
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid window")
+		return
+	}
+	delay, err := app.parseDelay(r)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid delay")
+		return
+	}
+
+	to := utils.CurrentMillis() - int64(delay/time.Millisecond)
+	resp, err := app.computeHRV(r.Context(), userID, to, window)
+	if err != nil {
+		if errors.Is(err, errNotEnoughRR) {
+			utils.SendError(w, http.StatusNotFound, nil, "Not enough RR intervals")
+		} else {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to retrieve data")
+		}
+		return
+	}
+	utils.SendResponse(w, http.StatusOK, "ok", resp)
+}
+
+// attachHRV 最新样本带有逐搏间期时附带截至该样本一分钟内的心率变异性，结果按样本缓存
+func (app *App) attachHRV(ctx context.Context, userID uint, resp *models.HeartRateDataResponse, measuredAt int64) {
+	if len(resp.RRIntervals) == 0 {
+		return
+	}
+	key := hrvSampleKey{userID: userID, measuredAt: measuredAt}
+	if metrics, ok := latestHRV.get(key); ok {
+		resp.HRV = metrics
+		return
+	}
+
+	result, err := app.computeHRV(ctx, userID, measuredAt, min(hrvLatestWindow, app.Config.HistoryWindow))
+	switch {
+	case err == nil:
+		resp.HRV = &result.HRVMetrics
+		latestHRV.set(key, resp.HRV)
+	case errors.Is(err, errNotEnoughRR):
+		latestHRV.set(key, nil)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/render"
+	"heart-rate-server/internal/utils"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	imageDefaultWidth  = 400
+	imageDefaultHeight = 150
+	imageMinWidth      = 100
+	imageMaxWidth      = 1200
+	imageMinHeight     = 50
+	imageMaxHeight     = 800
+
+	// imageCacheTTL 相同参数的图片在此时间内直接返回缓存，重复拉取不会重新绘制
+	imageCacheTTL = 5 * time.Second
+	// imageCacheMaxEntries 缓存条目上限，超过时清空
+	imageCacheMaxEntries = 1000
+)
+
+type cachedImage struct {
+	data    []byte
+	expires time.Time
+}
+
+// imageCache 进程内的短期图片缓存
+type imageCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedImage
+}
+
+var pngCache = &imageCache{entries: make(map[string]cachedImage)}
+
+func (c *imageCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+func (c *imageCache) set(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= imageCacheMaxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= imageCacheMaxEntries {
+			c.entries = make(map[string]cachedImage)
+		}
+	}
+	c.entries[key] = cachedImage{data: data, expires: now.Add(imageCacheTTL)}
+}
+
+type imageOptions struct {
+	Width, Height int
+	Theme         string
+	Minutes       int
+}
+
+func parseIntParam(value string, def, lo, hi int, name string) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%s must be between %d-%d", name, lo, hi)
+	}
+	return n, nil
+}
+
+// parseImageOptions 解析 ?width=&height=&theme=&minutes=，minutes 为0时不绘制趋势图
+func (app *App) parseImageOptions(r *http.Request) (imageOptions, error) {
+	query := r.URL.Query()
+	opts := imageOptions{Theme: query.Get("theme")}
+
+	var err error
+	if opts.Width, err = parseIntParam(query.Get("width"), imageDefaultWidth, imageMinWidth, imageMaxWidth, "width"); err != nil {
+		return opts, err
+	}
+	if opts.Height, err = parseIntParam(query.Get("height"), imageDefaultHeight, imageMinHeight, imageMaxHeight, "height"); err != nil {
+		return opts, err
+	}
+	maxMinutes := int(app.Config.HistoryWindow / time.Minute)
+	if opts.Minutes, err = parseIntParam(query.Get("minutes"), 0, 0, maxMinutes, "minutes"); err != nil {
+		return opts, err
+	}
+	if opts.Theme == "" {
+		opts.Theme = "dark"
+	}
+	if _, ok := render.Themes[opts.Theme]; !ok {
+		return opts, fmt.Errorf("unsupported theme: %q", opts.Theme)
+	}
+	return opts, nil
+}
+
+// PublicHeartRateImageHandler 以PNG图片展示当前心率和可选的最近N分钟趋势图，
+// 用于只接受位图的聊天集成
+func (app *App) PublicHeartRateImageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+
+	opts, err := app.parseImageOptions(r)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid image options")
+		return
+	}
+
+	policy, err := app.loadPublicPolicy(r.Context(), userID)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to load privacy settings")
+		return
+	}
+
+	key := fmt.Sprintf("%d:%d:%d:%s:%d", userID, opts.Width, opts.Height, opts.Theme, opts.Minutes)
+	data, ok := pngCache.get(key)
+	if !ok {
+		data, err = app.renderHeartRateImage(r, userID, opts, policy)
+		if err != nil {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to render image")
+			return
+		}
+		pngCache.set(key, data)
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", badgeCacheControl)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		return
+	}
+}
+
+// renderHeartRateImage 绘制图片，不允许公开查看时只显示 private，区间模式下显示区间名称且不绘制趋势图
+func (app *App) renderHeartRateImage(r *http.Request, userID uint, opts imageOptions, policy *publicPolicy) ([]byte, error) {
+	img := render.Image{
+		Width:  opts.Width,
+		Height: opts.Height,
+		Theme:  render.Themes[opts.Theme],
+		Status: models.HeartRateStatusOffline,
+	}
+
+	if !policy.visibleAt(time.Now()) {
+		img.Status = "private"
+		return encodePNG(img)
+	}
+
+	// 没有数据时显示离线，而不是返回错误
+	if data, now, err := app.latestSample(r.Context(), userID, 0); err == nil {
+		resp := app.newHeartRateResponse(r.Context(), userID, *data, now)
+		policy.apply(&resp)
+		img.Status = resp.Status
+		if resp.Status != models.HeartRateStatusOffline {
+			img.HeartRate = resp.HeartRate
+			if resp.HeartRate == 0 {
+				img.Status = resp.ZoneName
+			}
+		}
+	}
+
+	if opts.Minutes > 0 && policy.Mode != models.PrivacyModeZone {
+		img.To = utils.CurrentMillis()
+		img.From = img.To - int64(opts.Minutes)*int64(time.Minute/time.Millisecond)
+		samples, err := app.Store.Range(r.Context(), userID, img.From, img.To)
+		if err != nil {
+			return nil, err
+		}
+		if samples, err = policy.applySamples(samples); err != nil {
+			return nil, err
+		}
+		img.Chart = make([]render.Point, 0, len(samples))
+		for _, sample := range samples {
+			img.Chart = append(img.Chart, render.Point{HeartRate: sample.Data.HeartRate, MeasuredAt: sample.MeasuredAt})
+		}
+	}
+
+	return encodePNG(img)
+}
+
+func encodePNG(img render.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := render.PNG(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPrivacyBucket = 10
+
+	// privacyCacheTTL 隐私设置在本实例缓存的时间，修改后其它实例最多在此时间后生效
+	privacyCacheTTL = 5 * time.Second
+)
+
+// errPublicHidden 当前不允许公开查看
+var errPublicHidden = errors.New("public viewing is disabled")
+
+func defaultPrivacyOptions() models.PrivacyOptions {
+	return models.PrivacyOptions{PublicEnabled: true, Mode: models.PrivacyModeExact}
+}
+
+// publicPolicy 解析后的隐私设置，决定公开接口能否访问以及返回的精度
+type publicPolicy struct {
+	models.PrivacyOptions
+	loc *time.Location
+}
+
+// visibleAt 判断 t 时刻是否允许公开查看
+func (p *publicPolicy) visibleAt(t time.Time) bool {
+	if !p.PublicEnabled {
+		return false
+	}
+	if len(p.Schedule) == 0 {
+		return true
+	}
+
+	t = t.In(p.loc)
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range p.Schedule {
+		start, _ := parseClock(window.Start)
+		end, _ := parseClock(window.End)
+		switch {
+		case start < end:
+			if minute >= start && minute < end && onDay(window.Days, t.Weekday()) {
+				return true
+			}
+		case start > end:
+			// 跨越午夜的时间段，午夜之后属于前一天开始的时间段
+			if minute >= start && onDay(window.Days, t.Weekday()) {
+				return true
+			}
+			if minute < end && onDay(window.Days, (t.Weekday()+6)%7) {
+				return true
+			}
+		default:
+			if onDay(window.Days, t.Weekday()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func onDay(days []int, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock 解析 "HH:MM"，返回当天的分钟数，允许 "24:00"
+func parseClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%02d:%02d", &hour, &minute); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// coarsen 按隐私模式降低心率精度，区间模式下返回0
+func (p *publicPolicy) coarsen(heartRate int) int {
+	switch p.Mode {
+	case models.PrivacyModeRounded:
+		bucket := p.Bucket
+		if bucket == 0 {
+			bucket = defaultPrivacyBucket
+		}
+		return (heartRate + bucket/2) / bucket * bucket
+	case models.PrivacyModeZone:
+		return 0
+	}
+	return heartRate
+}
+
+// apply 按隐私模式处理最新心率，区间已基于精确值计算。
+// 非精确模式下不公开附加数据，逐搏间期可以还原出精确心率
+func (p *publicPolicy) apply(resp *models.HeartRateDataResponse) {
+	if p.Mode == models.PrivacyModeExact {
+		return
+	}
+	resp.HeartRate = p.coarsen(resp.HeartRate)
+	resp.SampleExtras = models.SampleExtras{}
+	resp.HRV = nil
+}
+
+// applySamples 按隐私模式处理历史样本，区间模式下不公开历史
+func (p *publicPolicy) applySamples(samples []models.HeartRateData) ([]models.HeartRateData, error) {
+	switch p.Mode {
+	case models.PrivacyModeZone:
+		return nil, errPublicHidden
+	case models.PrivacyModeRounded:
+		rounded := make([]models.HeartRateData, len(samples))
+		for i, sample := range samples {
+			rounded[i] = sample
+			rounded[i].Data.HeartRate = p.coarsen(sample.Data.HeartRate)
+			rounded[i].Data.SampleExtras = models.SampleExtras{}
+		}
+		return rounded, nil
+	}
+	return samples, nil
+}
+
+// privacyPolicies 公开接口每次请求都需要读取隐私设置，在本实例短期缓存
+var privacyPolicies = newTTLCache[uint, *publicPolicy](privacyCacheTTL, 10000)
+
+func (app *App) loadPrivacyOptions(ctx context.Context, userID uint) (models.PrivacyOptions, error) {
+	var settings models.PrivacySettings
+	err := app.DB.WithContext(ctx).Where("user_id = ?", userID).First(&settings).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return defaultPrivacyOptions(), nil
+		}
+		return models.PrivacyOptions{}, err
+	}
+	return settings.Options, nil
+}
+
+// loadPublicPolicy 读取用户的隐私设置，供公开接口使用
+func (app *App) loadPublicPolicy(ctx context.Context, userID uint) (*publicPolicy, error) {
+	if policy, ok := privacyPolicies.get(userID); ok {
+		return policy, nil
+	}
+
+	opts, err := app.loadPrivacyOptions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(opts.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	policy := &publicPolicy{PrivacyOptions: opts, loc: loc}
+	privacyPolicies.set(userID, policy)
+	return policy, nil
+}
+
+// visiblePolicy 读取隐私设置并检查当前是否允许公开查看，不允许时写出403
+func (app *App) visiblePolicy(w http.ResponseWriter, r *http.Request, userID uint) (*publicPolicy, bool) {
+	policy, err := app.loadPublicPolicy(r.Context(), userID)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to load privacy settings")
+		return nil, false
+	}
+	if !policy.visibleAt(time.Now()) {
+		utils.SendError(w, http.StatusForbidden, nil, "Public viewing is disabled")
+		return nil, false
+	}
+	return policy, true
+}
+
+// GetPrivacyHandler 返回当前用户的隐私设置
+func (app *App) GetPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	opts, err := app.loadPrivacyOptions(r.Context(), authInfo.UserID)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+	utils.SendResponse(w, http.StatusOK, "", opts)
+}
+
+// SavePrivacyHandler 保存隐私设置，只影响公开接口
+func (app *App) SavePrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var opts models.PrivacyOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(opts); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	if _, err := time.LoadLocation(opts.Timezone); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid timezone")
+		return
+	}
+	for _, window := range opts.Schedule {
+		if _, err := parseClock(window.Start); err != nil {
+			utils.SendError(w, http.StatusBadRequest, err, "Invalid schedule")
+			return
+		}
+		if _, err := parseClock(window.End); err != nil {
+			utils.SendError(w, http.StatusBadRequest, err, "Invalid schedule")
+			return
+		}
+	}
+	if opts.Mode == models.PrivacyModeRounded && opts.Bucket == 0 {
+		opts.Bucket = defaultPrivacyBucket
+	}
+
+	var settings models.PrivacySettings
+	err := app.DB.Where("user_id = ?", authInfo.UserID).First(&settings).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		settings = models.PrivacySettings{UserID: authInfo.UserID, Options: opts}
+		err = app.DB.Create(&settings).Error
+	case err == nil:
+		settings.Options = opts
+		err = app.DB.Save(&settings).Error
+	}
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to save privacy settings")
+		return
+	}
+
+	privacyPolicies.delete(authInfo.UserID)
+	utils.SendResponse(w, http.StatusOK, "Privacy settings saved", opts)
+}
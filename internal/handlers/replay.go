@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/storage"
+	"heart-rate-server/internal/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minReplaySpeed = 0.25
+	maxReplaySpeed = 16
+
+	// maxReplayFuture 回放结束时间最多晚于当前时间的长度，容许客户端时钟偏差
+	maxReplayFuture = 24 * time.Hour
+)
+
+// replayOptions 传给组件模板的回放参数，Session 为空时组件加载后自动从头播放
+type replayOptions struct {
+	From           int64   `json:"from"`
+	To             int64   `json:"to"`
+	Speed          float64 `json:"speed"`
+	Session        string  `json:"session,omitempty"`
+	StaleAfterMs   int64   `json:"stale_after_ms"`
+	OfflineAfterMs int64   `json:"offline_after_ms"`
+}
+
+// parseReplayTime 解析毫秒时间戳或 RFC3339 时间
+func parseReplayTime(value string) (int64, error) {
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return millis, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %q", value)
+	}
+	return utils.TimeToMillis(t), nil
+}
+
+func parseReplaySpeed(value string) (float64, error) {
+	if value == "" {
+		return 1, nil
+	}
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid speed: %q", value)
+	}
+	return speed, validateReplaySpeed(speed)
+}
+
+func validateReplaySpeed(speed float64) error {
+	if speed < minReplaySpeed || speed > maxReplaySpeed {
+		return fmt.Errorf("speed must be between %g-%g", minReplaySpeed, float64(maxReplaySpeed))
+	}
+	return nil
+}
+
+// validateReplayRange 检查回放范围不超过配置的最长时间。时间先限制在合理区间内，
+// 按毫秒比较，避免相减或换算成 Duration 时溢出
+func (app *App) validateReplayRange(from, to int64) error {
+	if from <= 0 || to > utils.CurrentMillis()+maxReplayFuture.Milliseconds() {
+		return fmt.Errorf("replay range must be within recorded time")
+	}
+	if to <= from {
+		return fmt.Errorf("replay end must be after start")
+	}
+	if to-from > app.Config.ReplayMaxRange.Milliseconds() {
+		return fmt.Errorf("replay range must be at most %s", app.Config.ReplayMaxRange)
+	}
+	return nil
+}
+
+// resolveReplayOptions 从 ?replay=（会话）或 ?replay_from=&replay_to=&speed= 解析回放参数，
+// 不是回放请求时返回 nil
+func (app *App) resolveReplayOptions(r *http.Request, userID uint) (*replayOptions, int, error) {
+	query := r.URL.Query()
+	opts := &replayOptions{
+		StaleAfterMs:   int64(app.Config.StaleAfter / time.Millisecond),
+		OfflineAfterMs: int64(app.Config.OfflineAfter / time.Millisecond),
+	}
+
+	if id := query.Get("replay"); id != "" {
+		session, err := app.Replays.Get(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, storage.ErrReplayNotFound) {
+				return nil, http.StatusNotFound, err
+			}
+			return nil, http.StatusInternalServerError, err
+		}
+		if session.UserID != userID {
+			return nil, http.StatusNotFound, storage.ErrReplayNotFound
+		}
+		opts.From, opts.To, opts.Speed, opts.Session = session.From, session.To, session.Speed, session.ID
+		return opts, http.StatusOK, nil
+	}
+
+	fromValue, toValue := query.Get("replay_from"), query.Get("replay_to")
+	if fromValue == "" && toValue == "" {
+		return nil, http.StatusOK, nil
+	}
+
+	var err error
+	if opts.From, err = parseReplayTime(fromValue); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if opts.To, err = parseReplayTime(toValue); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if err := app.validateReplayRange(opts.From, opts.To); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if opts.Speed, err = parseReplaySpeed(query.Get("speed")); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return opts, http.StatusOK, nil
+}
+
+// replaySamples 从归档读取样本，未启用归档时只能回放Redis窗口内的数据
+func (app *App) replaySamples(r *http.Request, userID uint, from, to int64) ([]models.HeartRateData, error) {
+	if app.Archive.Enabled() {
+		return app.Archive.Range(r.Context(), userID, from, to)
+	}
+	return app.Store.Range(r.Context(), userID, from, to)
+}
+
+// replayRange 读取 ?from=&to=。没有时使用页面自身的回放参数（?replay= 或 ?replay_from=&replay_to=），
+// 签名链接的请求参数被替换为签名中的参数，只能读取签名的回放范围
+func (app *App) replayRange(r *http.Request, userID uint) (int64, int64, int, error) {
+	query := r.URL.Query()
+	if query.Get("from") == "" && query.Get("to") == "" {
+		opts, status, err := app.resolveReplayOptions(r, userID)
+		if err != nil {
+			return 0, 0, status, err
+		}
+		if opts == nil {
+			return 0, 0, http.StatusBadRequest, fmt.Errorf("from and to are required")
+		}
+		return opts.From, opts.To, http.StatusOK, nil
+	}
+
+	from, err := parseReplayTime(query.Get("from"))
+	if err != nil {
+		return 0, 0, http.StatusBadRequest, err
+	}
+	to, err := parseReplayTime(query.Get("to"))
+	if err != nil {
+		return 0, 0, http.StatusBadRequest, err
+	}
+	if err := app.validateReplayRange(from, to); err != nil {
+		return 0, 0, http.StatusBadRequest, err
+	}
+	return from, to, http.StatusOK, nil
+}
+
+// PublicReplaySamplesHandler 返回回放范围内的全部样本，组件在本地按时间播放
+func (app *App) PublicReplaySamplesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+
+	from, to, status, err := app.replayRange(r, userID)
+	if err != nil {
+		utils.SendError(w, status, err, "Invalid replay range")
+		return
+	}
+
+	policy, ok := app.visiblePolicy(w, r, userID)
+	if !ok {
+		return
+	}
+	samples, err := app.replaySamples(r, userID, from, to)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to retrieve data")
+		return
+	}
+	if samples, err = policy.applySamples(samples); err != nil {
+		utils.SendError(w, http.StatusForbidden, nil, "Replay is not public in zone mode")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, "ok", newHistoryResponse(from, to, samples))
+}
+
+// advanceReplay 把播放中的进度推进到 now（毫秒），到达终点后自动暂停
+func advanceReplay(state *models.ReplayState, now int64) {
+	if state.Playing {
+		state.Position += int64(float64(now-state.UpdatedAt) * state.Speed)
+		if state.Position >= state.To {
+			state.Position = state.To
+			state.Playing = false
+		}
+	}
+	state.UpdatedAt = now
+}
+
+// loadReplaySession 读取会话并推进到当前进度
+func (app *App) loadReplaySession(w http.ResponseWriter, r *http.Request) (*models.ReplaySession, bool) {
+	session, err := app.Replays.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, storage.ErrReplayNotFound) {
+			utils.SendError(w, http.StatusNotFound, nil, "Replay session not found")
+		} else {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to load replay session")
+		}
+		return nil, false
+	}
+	advanceReplay(&session.ReplayState, utils.CurrentMillis())
+	return session, true
+}
+
+// CreateReplayHandler 创建可远程控制的回放会话，返回组件地址和控制令牌。
+// 令牌只在创建时返回一次
+func (app *App) CreateReplayHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var req models.CreateReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	if err := app.validateReplayRange(req.From, req.To); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid replay range")
+		return
+	}
+	if req.Speed == 0 {
+		req.Speed = 1
+	}
+	if err := validateReplaySpeed(req.Speed); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid replay speed")
+		return
+	}
+
+	var user models.User
+	if err := app.DB.First(&user, authInfo.UserID).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	session, token, err := app.Replays.Create(r.Context(), user.ID, models.ReplayState{
+		From:      req.From,
+		To:        req.To,
+		Speed:     req.Speed,
+		Position:  req.From,
+		UpdatedAt: utils.CurrentMillis(),
+	})
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to create replay session")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusCreated, "Replay session created", models.CreateReplayResponse{
+		ID:           session.ID,
+		ControlToken: token,
+		WidgetURL:    "/uuid/widget/view/" + user.UUID + "?replay=" + url.QueryEscape(session.ID),
+		State:        session.ReplayState,
+	})
+}
+
+// PublicReplayStateHandler 返回会话当前的播放状态，组件定期同步
+func (app *App) PublicReplayStateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+
+	session, ok := app.loadReplaySession(w, r)
+	if !ok {
+		return
+	}
+	if session.UserID != userID {
+		utils.SendError(w, http.StatusNotFound, nil, "Replay session not found")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, "ok", session.ReplayState)
+}
+
+// replayToken 从 Authorization: Bearer 或 X-Replay-Token 请求头读取控制令牌
+func replayToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-Replay-Token")
+}
+
+// ReplayControlHandler 播放、暂停或跳转回放，供剪辑工具与视频同步，需要会话的控制令牌
+func (app *App) ReplayControlHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.loadReplaySession(w, r)
+	if !ok {
+		return
+	}
+	if !storage.CheckReplayToken(session, replayToken(r)) {
+		utils.SendError(w, http.StatusUnauthorized, nil, "Invalid replay token")
+		return
+	}
+
+	var req models.ReplayControlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	if req.Speed != 0 {
+		if err := validateReplaySpeed(req.Speed); err != nil {
+			utils.SendError(w, http.StatusBadRequest, err, "Invalid replay speed")
+			return
+		}
+		session.Speed = req.Speed
+	}
+
+	switch req.Action {
+	case "play":
+		// 已播放到终点时从头开始
+		if session.Position >= session.To {
+			session.Position = session.From
+		}
+		session.Playing = true
+	case "pause":
+		session.Playing = false
+	case "seek":
+		if req.Position < session.From || req.Position > session.To {
+			utils.SendError(w, http.StatusBadRequest, nil, "Position must be within the replay range")
+			return
+		}
+		session.Position = req.Position
+	}
+
+	if err := app.Replays.Save(r.Context(), session); err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to update replay session")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, "ok", session.ReplayState)
+}
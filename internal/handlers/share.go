@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"heart-rate-server/internal/middleware"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxShareLinks 每个用户同时有效的分享链接上限
+const maxShareLinks = 50
+
+func newShareLinkResponse(link models.ShareLink) models.ShareLinkResponse {
+	return models.ShareLinkResponse{
+		ID:        link.ID,
+		Label:     link.Label,
+		ExpiresAt: utils.TimeToMillis(link.ExpiresAt),
+		MaxViews:  link.MaxViews,
+		Views:     link.Views,
+		CreatedAt: utils.TimeToMillis(link.CreatedAt),
+	}
+}
+
+// CreateShareLinkHandler 创建限时分享链接，令牌只在创建时返回一次
+func (app *App) CreateShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var req models.CreateShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	var active int64
+	if err := app.DB.Model(&models.ShareLink{}).
+		Where("user_id = ? AND expires_at > ?", authInfo.UserID, time.Now()).
+		Count(&active).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+	if active >= maxShareLinks {
+		utils.SendError(w, http.StatusConflict, nil, "Too many active share links")
+		return
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to generate token")
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	link := models.ShareLink{
+		UserID:    authInfo.UserID,
+		TokenHash: middleware.HashShareToken(token),
+		Label:     req.Label,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresIn) * time.Second),
+		MaxViews:  req.MaxViews,
+	}
+	if err := app.DB.Create(&link).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to create share link")
+		return
+	}
+
+	resp := newShareLinkResponse(link)
+	resp.Token = token
+	resp.URL = "/s/" + token
+	utils.SendResponse(w, http.StatusCreated, "Share link created", resp)
+}
+
+// ListShareLinksHandler 列出当前用户的分享链接，包括已过期但未删除的
+func (app *App) ListShareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var links []models.ShareLink
+	if err := app.DB.Where("user_id = ?", authInfo.UserID).Order("created_at desc").Find(&links).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	resp := make([]models.ShareLinkResponse, 0, len(links))
+	for _, link := range links {
+		resp = append(resp, newShareLinkResponse(link))
+	}
+	utils.SendResponse(w, http.StatusOK, "", resp)
+}
+
+// RevokeShareLinkHandler 撤销分享链接，所有实例立即失效
+func (app *App) RevokeShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid share link ID")
+		return
+	}
+
+	var link models.ShareLink
+	if err := app.DB.Where("id = ? AND user_id = ?", id, authInfo.UserID).First(&link).Error; err != nil {
+		utils.SendError(w, http.StatusNotFound, nil, "Share link not found")
+		return
+	}
+	if err := app.DB.Unscoped().Delete(&link).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to revoke share link")
+		return
+	}
+
+	if err := app.ShareLinks.Invalidate(r.Context(), link.TokenHash); err != nil {
+		log.Printf("Failed to broadcast share link revocation: %v", err)
+	}
+	utils.SendResponse(w, http.StatusOK, "Share link revoked", nil)
+}
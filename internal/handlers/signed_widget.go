@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"heart-rate-server/internal/middleware"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func newWidgetSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SignWidgetHandler 为当前用户签发带过期时间的组件链接，样式和参数包含在签名中。
+// 用户首次签发时生成签名密钥
+func (app *App) SignWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var req models.SignWidgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	query, err := url.ParseQuery(req.Query)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid widget query")
+		return
+	}
+	if req.Style != "" {
+		query.Set("style", req.Style)
+	}
+	if style := query.Get("style"); style != "" && style != customWidgetStyle {
+		if _, ok := findWidgetStyle(style); !ok {
+			utils.SendError(w, http.StatusBadRequest, nil, "Unknown widget style")
+			return
+		}
+	}
+
+	var user models.User
+	if err := app.DB.First(&user, authInfo.UserID).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+	if user.WidgetSecret == "" {
+		secret, err := newWidgetSecret()
+		if err != nil {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to generate secret")
+			return
+		}
+		if err := app.DB.Model(&user).Update("widget_secret", secret).Error; err != nil {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to save secret")
+			return
+		}
+		if err := app.SignedLinks.Invalidate(r.Context(), user.ID); err != nil {
+			log.Printf("Failed to invalidate widget secret cache for user %d: %v", user.ID, err)
+		}
+		user.WidgetSecret = secret
+	}
+
+	expires := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+	token, err := middleware.SignWidgetToken(user.WidgetSecret, user.ID, query.Encode(), expires)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to sign widget link")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusCreated, "Widget link signed", models.SignWidgetResponse{
+		URL:       "/w/" + token,
+		ExpiresAt: utils.TimeToMillis(expires),
+	})
+}
+
+// RotateWidgetSecretHandler 轮换签名密钥，此前签发的所有签名链接立即失效
+func (app *App) RotateWidgetSecretHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	secret, err := newWidgetSecret()
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to generate secret")
+		return
+	}
+	if err := app.DB.Model(&models.User{}).Where("id = ?", authInfo.UserID).Update("widget_secret", secret).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to rotate secret")
+		return
+	}
+	if err := app.SignedLinks.Invalidate(r.Context(), authInfo.UserID); err != nil {
+		log.Printf("Failed to broadcast widget secret rotation: %v", err)
+	}
+	utils.SendResponse(w, http.StatusOK, "Signed widget links revoked", nil)
+}
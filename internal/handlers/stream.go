@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"heart-rate-server/internal/middleware"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+// streamHeartbeat 没有新样本时重发状态的间隔，使观看端能及时显示过期/离线
+const streamHeartbeat = 5 * time.Second
+
+// PublicHeartRateStreamHandler 以 Server-Sent Events 推送实时心率。
+// 指定 ?delay= 时每条样本在测量时间加上延迟后才推送，与延迟的直播画面对齐。
+// 隐私设置不再允许公开查看时（如离开公开时间段），或分享链接、签名链接过期、撤销时关闭连接
+func (app *App) PublicHeartRateStreamHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+
+	delay, err := app.parseDelay(r)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid delay")
+		return
+	}
+	delayMs := int64(delay / time.Millisecond)
+
+	policy, ok := app.visiblePolicy(w, r, userID)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// 长连接不受服务器写超时限制
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Streaming unsupported")
+		return
+	}
+
+	ctx := r.Context()
+	check, _ := ctx.Value("access_check").(middleware.AccessCheck)
+	samples, unsubscribe := app.Live.Subscribe(ctx, userID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ranks, err := app.loadDeviceRanks(ctx, userID)
+	if err != nil {
+		ranks = nil
+	}
+
+	// queue 已收到但尚未到推送时间的样本，按测量时间升序
+	var queue []models.HeartRateData
+	last, _, err := app.latestSample(ctx, userID, delay)
+	if err != nil {
+		last = nil
+	}
+	if delay > 0 {
+		now := utils.CurrentMillis()
+		if pending, err := app.Store.Range(ctx, userID, now-delayMs+1, now); err == nil {
+			queue = pending
+		}
+	}
+	if err := app.writeStreamEvent(ctx, w, rc, userID, last, delayMs, policy); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		var due <-chan time.Time
+		if len(queue) > 0 {
+			due = time.After(time.Until(utils.MillisToTime(queue[0].MeasuredAt + delayMs)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case data, ok := <-samples:
+			if !ok {
+				return
+			}
+			if delay > 0 {
+				queue = enqueueSample(queue, data)
+				continue
+			}
+			if !app.preferSample(ranks, last, data) {
+				continue
+			}
+			last = &data
+		case <-due:
+			data := queue[0]
+			queue = queue[1:]
+			if !app.preferSample(ranks, last, data) {
+				continue
+			}
+			last = &data
+		case <-ticker.C:
+		}
+
+		// 重新读取隐私设置和设备优先级，使修改在已打开的连接上生效
+		if policy, err = app.loadPublicPolicy(ctx, userID); err != nil || !policy.visibleAt(time.Now()) {
+			return
+		}
+		if check != nil && !check(ctx) {
+			return
+		}
+		if updated, err := app.loadDeviceRanks(ctx, userID); err == nil {
+			ranks = updated
+		}
+
+		if err := app.writeStreamEvent(ctx, w, rc, userID, last, delayMs, policy); err != nil {
+			return
+		}
+	}
+}
+
+// enqueueSample 按测量时间有序插入。订阅在读取 Store.Range 之前建立，
+// 同一样本可能既在初始队列中又从订阅收到，测量时间和设备都相同的样本只保留一条
+func enqueueSample(queue []models.HeartRateData, data models.HeartRateData) []models.HeartRateData {
+	i := len(queue)
+	for i > 0 && queue[i-1].MeasuredAt > data.MeasuredAt {
+		i--
+	}
+	for j := i - 1; j >= 0 && queue[j].MeasuredAt == data.MeasuredAt; j-- {
+		if queue[j].DeviceID == data.DeviceID {
+			return queue
+		}
+	}
+	queue = append(queue, models.HeartRateData{})
+	copy(queue[i+1:], queue[i:])
+	queue[i] = data
+	return queue
+}
+
+// writeStreamEvent 写出一条 heart_rate 事件，没有数据时只携带离线状态
+func (app *App) writeStreamEvent(ctx context.Context, w http.ResponseWriter, rc *http.ResponseController, userID uint,
+	data *models.HeartRateData, delayMs int64, policy *publicPolicy) error {
+	var payload interface{} = map[string]string{"status": models.HeartRateStatusOffline}
+	if data != nil {
+		now := utils.CurrentMillis() - delayMs
+		resp := app.newHeartRateResponse(ctx, userID, *data, now)
+		if policy.Mode == models.PrivacyModeExact {
+			app.attachHRV(ctx, userID, &resp, data.MeasuredAt)
+		}
+		policy.apply(&resp)
+		payload = resp
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode stream event: %v", err)
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: heart_rate\ndata: %s\n\n", jsonData); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"heart-rate-server/internal/webhook"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// maxWebhooks 每个用户最多登记的Webhook数
+	maxWebhooks = 10
+
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+func newWebhookResponse(webhook models.Webhook) models.WebhookResponse {
+	return models.WebhookResponse{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    webhook.Events,
+		Enabled:   webhook.Enabled,
+		Format:    webhook.Format,
+		Template:  webhook.Template,
+		CreatedAt: utils.TimeToMillis(webhook.CreatedAt),
+	}
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// decodeWebhookRequest 只接受 http/https 地址，是否为公网地址在投递时检查。
+// 模板只在 template 格式下保存
+func decodeWebhookRequest(w http.ResponseWriter, r *http.Request) (models.WebhookRequest, bool) {
+	var req models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return req, false
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return req, false
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		utils.SendError(w, http.StatusBadRequest, fmt.Errorf("url must be an http or https URL"), "Validation failed")
+		return req, false
+	}
+	if req.Format == "" {
+		req.Format = models.WebhookFormatGeneric
+	}
+	if req.Format != models.WebhookFormatTemplate {
+		req.Template = ""
+	}
+	if err := webhook.ValidateFormat(req.Format, req.URL, req.Template); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return req, false
+	}
+	return req, true
+}
+
+// ListWebhooksHandler 列出当前用户的Webhook，不返回签名密钥
+func (app *App) ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var webhooks []models.Webhook
+	if err := app.DB.Where("user_id = ?", authInfo.UserID).Order("id").Find(&webhooks).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	resp := make([]models.WebhookResponse, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		resp = append(resp, newWebhookResponse(webhook))
+	}
+	utils.SendResponse(w, http.StatusOK, "", resp)
+}
+
+// CreateWebhookHandler 登记Webhook并生成签名密钥，密钥只在创建时返回一次
+func (app *App) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	req, ok := decodeWebhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var count int64
+	if err := app.DB.Model(&models.Webhook{}).Where("user_id = ?", authInfo.UserID).Count(&count).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+	if count >= maxWebhooks {
+		utils.SendError(w, http.StatusConflict, nil, "Too many webhooks")
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to generate secret")
+		return
+	}
+	webhook := models.Webhook{
+		UserID:   authInfo.UserID,
+		URL:      req.URL,
+		Secret:   secret,
+		Events:   req.Events,
+		Enabled:  req.Enabled == nil || *req.Enabled,
+		Format:   req.Format,
+		Template: req.Template,
+	}
+	if err := app.DB.Create(&webhook).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to create webhook")
+		return
+	}
+	app.Webhooks.Invalidate(authInfo.UserID)
+
+	resp := newWebhookResponse(webhook)
+	resp.Secret = secret
+	utils.SendResponse(w, http.StatusCreated, "Webhook created", resp)
+}
+
+// UpdateWebhookHandler 修改地址、订阅的事件、格式和启用状态，密钥不变
+func (app *App) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	webhook, ok := app.findWebhook(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+	req, ok := decodeWebhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	webhook.URL = req.URL
+	webhook.Events = req.Events
+	webhook.Enabled = req.Enabled == nil || *req.Enabled
+	webhook.Format = req.Format
+	webhook.Template = req.Template
+	if err := app.DB.Save(&webhook).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to update webhook")
+		return
+	}
+	app.Webhooks.Invalidate(authInfo.UserID)
+
+	utils.SendResponse(w, http.StatusOK, "Webhook updated", newWebhookResponse(webhook))
+}
+
+// DeleteWebhookHandler 删除Webhook及其投递记录，队列中尚未投递的事件被丢弃
+func (app *App) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	webhook, ok := app.findWebhook(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+	if err := app.DB.Unscoped().Delete(&webhook).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to delete webhook")
+		return
+	}
+	if err := app.DB.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to delete webhook deliveries")
+		return
+	}
+	app.Webhooks.Invalidate(authInfo.UserID)
+
+	utils.SendResponse(w, http.StatusOK, "Webhook deleted", nil)
+}
+
+// RotateWebhookSecretHandler 生成新的签名密钥，旧密钥立即失效
+func (app *App) RotateWebhookSecretHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	webhook, ok := app.findWebhook(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to generate secret")
+		return
+	}
+	if err := app.DB.Model(&webhook).Update("secret", secret).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to rotate secret")
+		return
+	}
+	app.Webhooks.Invalidate(authInfo.UserID)
+
+	resp := newWebhookResponse(webhook)
+	resp.Secret = secret
+	utils.SendResponse(w, http.StatusOK, "Webhook secret rotated", resp)
+}
+
+// PingWebhookHandler 发送 ping 测试事件，停用的Webhook同样发送
+func (app *App) PingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	webhook, ok := app.findWebhook(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+	eventID, err := app.Webhooks.Ping(r.Context(), webhook)
+	if err != nil {
+		utils.SendError(w, http.StatusServiceUnavailable, err, "Failed to enqueue ping")
+		return
+	}
+	utils.SendResponse(w, http.StatusAccepted, "Ping queued", map[string]string{"event_id": eventID})
+}
+
+// WebhookDeliveriesHandler 投递记录，按时间倒序，支持 ?limit=
+func (app *App) WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	webhook, ok := app.findWebhook(w, r, authInfo.UserID)
+	if !ok {
+		return
+	}
+	limit := defaultDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			utils.SendError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1-%d", maxDeliveryLimit), "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := app.DB.Where("webhook_id = ?", webhook.ID).Order("created_at DESC, id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	resp := make([]models.WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		resp = append(resp, models.WebhookDeliveryResponse{
+			ID:         delivery.ID,
+			EventID:    delivery.EventID,
+			Event:      delivery.Event,
+			Attempt:    delivery.Attempt,
+			Status:     delivery.Status,
+			StatusCode: delivery.StatusCode,
+			Error:      delivery.Error,
+			DurationMs: delivery.DurationMs,
+			CreatedAt:  utils.TimeToMillis(delivery.CreatedAt),
+		})
+	}
+	utils.SendResponse(w, http.StatusOK, "", resp)
+}
+
+func (app *App) findWebhook(w http.ResponseWriter, r *http.Request, userID uint) (models.Webhook, bool) {
+	var webhook models.Webhook
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid webhook ID")
+		return webhook, false
+	}
+	if err := app.DB.Where("id = ? AND user_id = ?", id, userID).First(&webhook).Error; err != nil {
+		utils.SendError(w, http.StatusNotFound, nil, "Webhook not found")
+		return webhook, false
+	}
+	return webhook, true
+}
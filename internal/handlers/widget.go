@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// widgetFont 可选字体，只允许白名单中的字体以避免注入任意CSS
+type widgetFont struct {
+	Family template.CSS
+	Import template.URL
+}
+
+var widgetFonts = map[string]widgetFont{
+	"young-serif": {
+		Family: `'Young Serif', serif`,
+		Import: "https://fonts.googleapis.com/css2?family=Young+Serif&display=swap",
+	},
+	"orbitron": {
+		Family: `'Orbitron', sans-serif`,
+		Import: "https://fonts.googleapis.com/css2?family=Orbitron:wght@600&display=swap",
+	},
+	"roboto-mono": {
+		Family: `'Roboto Mono', monospace`,
+		Import: "https://fonts.googleapis.com/css2?family=Roboto+Mono:wght@500&display=swap",
+	},
+	"press-start": {
+		Family: `'Press Start 2P', monospace`,
+		Import: "https://fonts.googleapis.com/css2?family=Press+Start+2P&display=swap",
+	},
+	"noto-sans-sc": {
+		Family: `'Noto Sans SC', sans-serif`,
+		Import: "https://fonts.googleapis.com/css2?family=Noto+Sans+SC:wght@500&display=swap",
+	},
+	"system": {
+		Family: `system-ui, sans-serif`,
+	},
+}
+
+// widgetStyle 内置组件样式，Files 中第一个文件为页面模板
+type widgetStyle struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Files       []string `json:"-"`
+}
+
+const defaultWidgetStyle = "default"
+
+var widgetStyles = []widgetStyle{
+	{Name: "default", Description: "跳动的心形与数字", Files: []string{"templates/default.html"}},
+	{Name: "minimal", Description: "仅显示数字", Files: []string{"templates/widgets/minimal.html", "templates/widgets/common.html"}},
+	{Name: "gauge", Description: "半圆仪表盘", Files: []string{"templates/widgets/gauge.html", "templates/widgets/common.html"}},
+	{Name: "ecg", Description: "滚动的心电图波形", Files: []string{"templates/widgets/ecg.html", "templates/widgets/common.html"}},
+	{Name: "badge", Description: "紧凑徽章", Files: []string{"templates/widgets/badge.html", "templates/widgets/common.html"}},
+	{Name: "chart", Description: "最近N分钟的趋势图", Files: []string{"templates/widgets/chart.html", "templates/widgets/common.html"}},
+}
+
+func findWidgetStyle(name string) (widgetStyle, bool) {
+	for _, style := range widgetStyles {
+		if style.Name == name {
+			return style, true
+		}
+	}
+	return widgetStyle{}, false
+}
+
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+const (
+	widgetMinSize  = 12
+	widgetMaxSize  = 300
+	widgetMaxLabel = 32
+)
+
+func defaultWidgetOptions() models.WidgetOptions {
+	return models.WidgetOptions{
+		HeartColor: "#f20044",
+		TextColor:  "#ffffff",
+		Background: "transparent",
+		Font:       "young-serif",
+		Size:       50,
+		Animate:    true,
+		Align:      "center",
+		Minutes:    5,
+	}
+}
+
+// normalizeColor 允许省略 #，URL中 # 需要转义
+func normalizeColor(value string) string {
+	if value != "" && value != "transparent" && !strings.HasPrefix(value, "#") {
+		return "#" + value
+	}
+	return value
+}
+
+// parseWidgetOptions 以 base 为基础应用查询参数中的外观配置
+func parseWidgetOptions(query url.Values, base models.WidgetOptions) (models.WidgetOptions, error) {
+	opts := base
+
+	if v := query.Get("heart_color"); v != "" {
+		opts.HeartColor = normalizeColor(v)
+	}
+	if v := query.Get("text_color"); v != "" {
+		opts.TextColor = normalizeColor(v)
+	}
+	if v := query.Get("background"); v != "" {
+		opts.Background = normalizeColor(v)
+	}
+	if v := query.Get("font"); v != "" {
+		opts.Font = v
+	}
+	if v := query.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid size: %q", v)
+		}
+		opts.Size = size
+	}
+	if v := query.Get("animate"); v != "" {
+		animate, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid animate: %q", v)
+		}
+		opts.Animate = animate
+	}
+	if _, ok := query["label"]; ok {
+		opts.Label = query.Get("label")
+	}
+	if v := query.Get("align"); v != "" {
+		opts.Align = v
+	}
+	if v := query.Get("minutes"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid minutes: %q", v)
+		}
+		opts.Minutes = minutes
+	}
+	if v := query.Get("delay"); v != "" {
+		delay, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid delay: %q", v)
+		}
+		opts.Delay = delay
+	}
+	if v := query.Get("zone_colors"); v != "" {
+		zoneColors, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid zone_colors: %q", v)
+		}
+		opts.ZoneColors = zoneColors
+	}
+
+	return opts, validateWidgetOptions(opts)
+}
+
+func validateWidgetOptions(opts models.WidgetOptions) error {
+	if !hexColorPattern.MatchString(opts.HeartColor) {
+		return fmt.Errorf("invalid heart_color: %q", opts.HeartColor)
+	}
+	if !hexColorPattern.MatchString(opts.TextColor) {
+		return fmt.Errorf("invalid text_color: %q", opts.TextColor)
+	}
+	if opts.Background != "transparent" && !hexColorPattern.MatchString(opts.Background) {
+		return fmt.Errorf("invalid background: %q", opts.Background)
+	}
+	if _, ok := widgetFonts[opts.Font]; !ok {
+		return fmt.Errorf("unsupported font: %q", opts.Font)
+	}
+	if opts.Size < widgetMinSize || opts.Size > widgetMaxSize {
+		return fmt.Errorf("size must be between %d-%d", widgetMinSize, widgetMaxSize)
+	}
+	if utf8.RuneCountInString(opts.Label) > widgetMaxLabel {
+		return fmt.Errorf("label must be at most %d characters", widgetMaxLabel)
+	}
+	switch opts.Align {
+	case "left", "center", "right":
+	default:
+		return fmt.Errorf("invalid align: %q", opts.Align)
+	}
+	if opts.Minutes < 1 {
+		return fmt.Errorf("minutes must be at least 1")
+	}
+	if opts.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	return nil
+}
+
+// resolveWidgetOptions 依次应用默认值、用户预设和查询参数
+func (app *App) resolveWidgetOptions(r *http.Request, userID uint) (models.WidgetOptions, int, error) {
+	opts := defaultWidgetOptions()
+	query := r.URL.Query()
+
+	if name := query.Get("preset"); name != "" {
+		var preset models.WidgetPreset
+		err := app.DB.Where("user_id = ? AND name = ?", userID, name).First(&preset).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return opts, http.StatusNotFound, fmt.Errorf("preset %q not found", name)
+			}
+			return opts, http.StatusInternalServerError, err
+		}
+		opts = preset.Options
+		// 早期保存的预设没有 minutes 字段
+		if opts.Minutes == 0 {
+			opts.Minutes = defaultWidgetOptions().Minutes
+		}
+	}
+
+	opts, err := parseWidgetOptions(query, opts)
+	if err != nil {
+		return opts, http.StatusBadRequest, err
+	}
+	if maxMinutes := int(app.Config.HistoryWindow / time.Minute); opts.Minutes > maxMinutes {
+		return opts, http.StatusBadRequest, fmt.Errorf("minutes must be at most %d", maxMinutes)
+	}
+	if maxDelay := int(app.maxDelay() / time.Second); opts.Delay > maxDelay {
+		return opts, http.StatusBadRequest, fmt.Errorf("delay must be at most %d seconds", maxDelay)
+	}
+	return opts, http.StatusOK, nil
+}
+
+// PublicHeartRateHTMLHandler 渲染心率展示组件，样式来自路径 /uuid/widget/{style}/{uuid}
+// 或查询参数 ?style=，默认为 default
+func (app *App) PublicHeartRateHTMLHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	base := dataBase(r)
+
+	userID, ok := r.Context().Value("cached_user_id").(uint)
+	if !ok {
+		utils.SendError(w, http.StatusBadRequest, nil, "Missing user identification")
+		return
+	}
+	if _, unsigned := vars["uuid"]; unsigned {
+		policy, err := app.loadPublicPolicy(r.Context(), userID)
+		if err != nil {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to load privacy settings")
+			return
+		}
+		if policy.RequireSignedWidgets {
+			utils.SendError(w, http.StatusForbidden, nil, "Widget requires a signed link")
+			return
+		}
+	}
+
+	styleName := vars["style"]
+	if styleName == "" {
+		styleName = r.URL.Query().Get("style")
+	}
+	if styleName == "" {
+		styleName = defaultWidgetStyle
+	}
+	replay, status, err := app.resolveReplayOptions(r, userID)
+	if err != nil {
+		utils.SendError(w, status, err, "Invalid replay options")
+		return
+	}
+	if styleName == customWidgetStyle {
+		delay, err := app.parseDelay(r)
+		if err != nil {
+			utils.SendError(w, http.StatusBadRequest, err, "Invalid delay")
+			return
+		}
+		app.publicCustomWidget(w, userID, widgetSource{DataBase: base, Delay: int(delay / time.Second), Replay: replay})
+		return
+	}
+	style, ok := findWidgetStyle(styleName)
+	if !ok {
+		utils.SendError(w, http.StatusNotFound, nil, "Unknown widget style")
+		return
+	}
+
+	opts, status, err := app.resolveWidgetOptions(r, userID)
+	if err != nil {
+		utils.SendError(w, status, err, "Invalid widget options")
+		return
+	}
+
+	// 使用Go模板渲染HTML
+	tmpl, err := app.Templates.Get(style.Files...)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to load template")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	err2 := tmpl.Execute(w, map[string]interface{}{
+		"DataBase": base,
+		"Style":    style.Name,
+		"Options":  opts,
+		"Font":     widgetFonts[opts.Font],
+		"Replay":   replay,
+	})
+	if err2 != nil {
+		return
+	}
+}
+
+// dataBase 组件请求数据的接口前缀，通过分享链接或签名链接访问时不暴露UUID。
+// 限制查看次数的分享链接带上本次打开页面签发的查看会话
+func dataBase(r *http.Request) string {
+	vars := mux.Vars(r)
+	if token, ok := vars["token"]; ok {
+		if view, ok := r.Context().Value("share_view").(string); ok {
+			return "/s/" + token + "/v/" + view
+		}
+		return "/s/" + token
+	}
+	if signed, ok := vars["signed"]; ok {
+		return "/w/" + signed
+	}
+	return "/uuid/" + vars["uuid"]
+}
+
+// WidgetStylesHandler 列出可用的组件样式
+func (app *App) WidgetStylesHandler(w http.ResponseWriter, r *http.Request) {
+	utils.SendResponse(w, http.StatusOK, "", widgetStyles)
+}
+
+// ListWidgetPresetsHandler 列出当前用户的外观预设
+func (app *App) ListWidgetPresetsHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var presets []models.WidgetPreset
+	if err := app.DB.Where("user_id = ?", authInfo.UserID).Order("name").Find(&presets).Error; err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+
+	resp := make([]models.WidgetPresetResponse, 0, len(presets))
+	for _, preset := range presets {
+		resp = append(resp, models.WidgetPresetResponse{Name: preset.Name, Options: preset.Options})
+	}
+	utils.SendResponse(w, http.StatusOK, "", resp)
+}
+
+// SaveWidgetPresetHandler 创建或覆盖指定名称的预设，未提供的字段使用默认值
+func (app *App) SaveWidgetPresetHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+	name := mux.Vars(r)["name"]
+	if name == "" || utf8.RuneCountInString(name) > 50 {
+		utils.SendError(w, http.StatusBadRequest, nil, "Preset name must be 1-50 characters")
+		return
+	}
+
+	opts := defaultWidgetOptions()
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	opts.HeartColor = normalizeColor(opts.HeartColor)
+	opts.TextColor = normalizeColor(opts.TextColor)
+	opts.Background = normalizeColor(opts.Background)
+	if err := validateWidgetOptions(opts); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	var preset models.WidgetPreset
+	err := app.DB.Where("user_id = ? AND name = ?", authInfo.UserID, name).First(&preset).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		preset = models.WidgetPreset{UserID: authInfo.UserID, Name: name, Options: opts}
+		err = app.DB.Create(&preset).Error
+	case err == nil:
+		preset.Options = opts
+		err = app.DB.Save(&preset).Error
+	}
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to save preset")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, "Preset saved", models.WidgetPresetResponse{Name: preset.Name, Options: preset.Options})
+}
+
+// DeleteWidgetPresetHandler 删除指定名称的预设
+func (app *App) DeleteWidgetPresetHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+	name := mux.Vars(r)["name"]
+
+	result := app.DB.Unscoped().Where("user_id = ? AND name = ?", authInfo.UserID, name).Delete(&models.WidgetPreset{})
+	if result.Error != nil {
+		utils.SendError(w, http.StatusInternalServerError, result.Error, "Failed to delete preset")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.SendError(w, http.StatusNotFound, nil, "Preset not found")
+		return
+	}
+
+	utils.SendResponse(w, http.StatusOK, "Preset deleted", nil)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 没有填写时使用的心率，有年龄时最大心率按 220-年龄 推算
+	defaultMaxHR     = 190
+	defaultRestingHR = 60
+
+	// zoneCacheTTL 心率区间在本实例缓存的时间，修改后其它实例最多在此时间后生效
+	zoneCacheTTL = 5 * time.Second
+)
+
+// zoneNames 区间名称，下标即区间编号，0为低于第1区间
+var zoneNames = []string{"rest", "very_light", "light", "moderate", "hard", "maximum"}
+
+// defaultZoneBoundaries 第1至5区间下限的百分比
+var defaultZoneBoundaries = []int{50, 60, 70, 80, 90}
+
+func defaultHeartRateProfile() models.HeartRateProfile {
+	return models.HeartRateProfile{Method: models.ZoneMethodPercentMax}
+}
+
+// zoneTable 按个人资料换算出的各区间下限（次/分），升序
+type zoneTable struct {
+	maxHR     int
+	restingHR int
+	bounds    []int
+}
+
+func newZoneTable(profile models.HeartRateProfile) zoneTable {
+	t := zoneTable{maxHR: profile.MaxHR, restingHR: profile.RestingHR}
+	if t.maxHR == 0 {
+		t.maxHR = defaultMaxHR
+		if profile.Age > 0 {
+			t.maxHR = 220 - profile.Age
+		}
+	}
+	if t.restingHR == 0 {
+		t.restingHR = defaultRestingHR
+	}
+
+	boundaries := profile.Boundaries
+	if len(boundaries) == 0 {
+		boundaries = defaultZoneBoundaries
+	}
+	t.bounds = make([]int, len(boundaries))
+	for i, percent := range boundaries {
+		if profile.Method == models.ZoneMethodKarvonen {
+			t.bounds[i] = t.restingHR + ((t.maxHR-t.restingHR)*percent+50)/100
+		} else {
+			t.bounds[i] = (t.maxHR*percent + 50) / 100
+		}
+	}
+	return t
+}
+
+// classify 返回心率所在区间的编号和名称
+func (t zoneTable) classify(heartRate int) (int, string) {
+	index := 0
+	for index < len(t.bounds) && heartRate >= t.bounds[index] {
+		index++
+	}
+	return index, zoneNames[index]
+}
+
+func (t zoneTable) zones() []models.HeartRateZone {
+	zones := make([]models.HeartRateZone, 0, len(t.bounds)+1)
+	for i := 0; i <= len(t.bounds); i++ {
+		zone := models.HeartRateZone{Index: i, Name: zoneNames[i]}
+		if i > 0 {
+			zone.Min = t.bounds[i-1]
+		}
+		if i < len(t.bounds) {
+			zone.Max = t.bounds[i]
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// zoneTables 每个最新心率响应都需要用户的心率区间，在本实例短期缓存
+var zoneTables = newTTLCache[uint, zoneTable](zoneCacheTTL, 10000)
+
+func (app *App) loadProfile(ctx context.Context, userID uint) (models.HeartRateProfile, error) {
+	var profile models.UserProfile
+	err := app.DB.WithContext(ctx).Where("user_id = ?", userID).First(&profile).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return defaultHeartRateProfile(), nil
+		}
+		return models.HeartRateProfile{}, err
+	}
+	return profile.Profile, nil
+}
+
+// loadZoneTable 读取用户的心率区间，数据库出错时使用默认区间，不影响心率数据的返回
+func (app *App) loadZoneTable(ctx context.Context, userID uint) zoneTable {
+	if table, ok := zoneTables.get(userID); ok {
+		return table
+	}
+
+	profile, err := app.loadProfile(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load profile for user %d: %v", userID, err)
+		return newZoneTable(defaultHeartRateProfile())
+	}
+	table := newZoneTable(profile)
+	zoneTables.set(userID, table)
+	return table
+}
+
+func newProfileResponse(profile models.HeartRateProfile) models.ProfileResponse {
+	table := newZoneTable(profile)
+	return models.ProfileResponse{
+		HeartRateProfile:   profile,
+		EffectiveMaxHR:     table.maxHR,
+		EffectiveRestingHR: table.restingHR,
+		Zones:              table.zones(),
+	}
+}
+
+// validateProfile 检查字段之间的关系，单个字段的范围由 validate 标签检查
+func validateProfile(profile models.HeartRateProfile) error {
+	table := newZoneTable(profile)
+	if table.restingHR >= table.maxHR {
+		return fmt.Errorf("resting_hr must be lower than max_hr (%d)", table.maxHR)
+	}
+	for i := 1; i < len(profile.Boundaries); i++ {
+		if profile.Boundaries[i] <= profile.Boundaries[i-1] {
+			return fmt.Errorf("boundaries must be in ascending order")
+		}
+	}
+	return nil
+}
+
+// GetProfileHandler 返回当前用户的个人资料和心率区间
+func (app *App) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	profile, err := app.loadProfile(r.Context(), authInfo.UserID)
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Database error")
+		return
+	}
+	utils.SendResponse(w, http.StatusOK, "", newProfileResponse(profile))
+}
+
+// SaveProfileHandler 保存个人资料，最新心率接口按新的区间返回
+func (app *App) SaveProfileHandler(w http.ResponseWriter, r *http.Request) {
+	authInfo := r.Context().Value("authInfo").(*models.AuthInfo)
+
+	var req models.HeartRateProfile
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+	if err := validateProfile(req); err != nil {
+		utils.SendError(w, http.StatusBadRequest, err, "Validation failed")
+		return
+	}
+
+	var profile models.UserProfile
+	err := app.DB.Where("user_id = ?", authInfo.UserID).First(&profile).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		profile = models.UserProfile{UserID: authInfo.UserID, Profile: req}
+		err = app.DB.Create(&profile).Error
+	case err == nil:
+		profile.Profile = req
+		err = app.DB.Save(&profile).Error
+	}
+	if err != nil {
+		utils.SendError(w, http.StatusInternalServerError, err, "Failed to save profile")
+		return
+	}
+
+	zoneTables.delete(authInfo.UserID)
+	utils.SendResponse(w, http.StatusOK, "Profile saved", newProfileResponse(req))
+}
@@ -0,0 +1,159 @@
+// Package hrv 根据逐搏间期（RR间期）计算心率变异性指标
+package hrv
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// 生理范围之外的间期视为伪迹（毫秒）
+	minRR = 300
+	maxRR = 2000
+	// ectopicThreshold 与近期正常间期中位数相差超过该比例的间期视为异位搏动
+	ectopicThreshold = 0.2
+	// medianBeats 计算参考中位数使用的近期正常间期数
+	medianBeats = 5
+	// reseedBeats 连续这么多个彼此一致的间期被判为异位搏动时，认为心率发生了阶跃变化，
+	// 用它们重新建立参考
+	reseedBeats = 3
+
+	// 计算指标所需的最少正常间期数与逐搏差值数
+	minBeats       = 10
+	minDifferences = 5
+)
+
+// Metrics 时域心率变异性指标，时间单位为毫秒
+type Metrics struct {
+	RMSSD  float64
+	SDNN   float64
+	PNN50  float64
+	MeanRR float64
+	// Beats 参与计算的正常间期数，Artifacts 被剔除的间期数
+	Beats     int
+	Artifacts int
+}
+
+// Compute 计算指标。segments 为按时间排列的连续间期序列，不同序列之间可能缺失搏动，
+// 不计算跨越序列边界的逐搏差值，参考中位数也在边界处重新建立。
+// 伪迹和异位搏动被剔除，其前后也不计算差值。正常间期不足时返回 false
+func Compute(segments [][]int) (Metrics, bool) {
+	var (
+		m     Metrics
+		nn    []float64
+		diffs []float64
+	)
+
+	for _, segment := range segments {
+		var (
+			prev     float64
+			recent   []float64
+			rejected []float64
+		)
+		continuous := false
+		for _, v := range segment {
+			rr := float64(v)
+			if v < minRR || v > maxRR {
+				m.Artifacts++
+				continuous = false
+				continue
+			}
+			if isEctopic(rr, recent) {
+				m.Artifacts++
+				continuous = false
+				rejected = append(rejected, rr)
+				if len(rejected) > reseedBeats {
+					rejected = rejected[1:]
+				}
+				if len(rejected) == reseedBeats && consistent(rejected) {
+					recent, rejected = append([]float64(nil), rejected...), nil
+				}
+				continue
+			}
+
+			rejected = rejected[:0]
+			nn = append(nn, rr)
+			if continuous {
+				diffs = append(diffs, rr-prev)
+			}
+			prev, continuous = rr, true
+
+			recent = append(recent, rr)
+			if len(recent) > medianBeats {
+				recent = recent[1:]
+			}
+		}
+	}
+
+	if len(nn) < minBeats || len(diffs) < minDifferences {
+		return m, false
+	}
+
+	m.Beats = len(nn)
+	m.MeanRR = mean(nn)
+
+	var sumSquares float64
+	for _, rr := range nn {
+		sumSquares += (rr - m.MeanRR) * (rr - m.MeanRR)
+	}
+	m.SDNN = math.Sqrt(sumSquares / float64(len(nn)-1))
+
+	var sumDiffs float64
+	over50 := 0
+	for _, d := range diffs {
+		sumDiffs += d * d
+		if math.Abs(d) > 50 {
+			over50++
+		}
+	}
+	m.RMSSD = math.Sqrt(sumDiffs / float64(len(diffs)))
+	m.PNN50 = float64(over50) / float64(len(diffs)) * 100
+
+	m.RMSSD = round1(m.RMSSD)
+	m.SDNN = round1(m.SDNN)
+	m.PNN50 = round1(m.PNN50)
+	m.MeanRR = round1(m.MeanRR)
+	return m, true
+}
+
+// isEctopic 近期正常间期不足时无法判断，视为正常
+func isEctopic(rr float64, recent []float64) bool {
+	if len(recent) < 3 {
+		return false
+	}
+	ref := median(recent)
+	return math.Abs(rr-ref) > ref*ectopicThreshold
+}
+
+// consistent 间期彼此都不构成异位搏动，即与它们自身的中位数相差不超过阈值
+func consistent(values []float64) bool {
+	ref := median(values)
+	for _, v := range values {
+		if math.Abs(v-ref) > ref*ectopicThreshold {
+			return false
+		}
+	}
+	return true
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
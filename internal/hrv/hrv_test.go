@@ -0,0 +1,97 @@
+package hrv
+
+import "testing"
+
+// alternating 生成 n 个在 a、b 之间交替的间期
+func alternating(n, a, b int) []int {
+	rr := make([]int, n)
+	for i := range rr {
+		rr[i] = a
+		if i%2 == 1 {
+			rr[i] = b
+		}
+	}
+	return rr
+}
+
+func repeat(n, v int) []int {
+	rr := make([]int, n)
+	for i := range rr {
+		rr[i] = v
+	}
+	return rr
+}
+
+func TestComputeMetrics(t *testing.T) {
+	m, ok := Compute([][]int{alternating(20, 800, 860)})
+	if !ok {
+		t.Fatal("expected metrics")
+	}
+	// 逐搏差值均为 ±60；与均值 830 的偏差均为 ±30，SDNN = sqrt(20*900/19)
+	want := Metrics{RMSSD: 60, SDNN: 30.8, PNN50: 100, MeanRR: 830, Beats: 20}
+	if m != want {
+		t.Fatalf("got %+v, want %+v", m, want)
+	}
+}
+
+func TestComputePNN50Boundary(t *testing.T) {
+	// 差值恰好 50ms 不计入 pNN50
+	m, ok := Compute([][]int{alternating(20, 800, 850)})
+	if !ok {
+		t.Fatal("expected metrics")
+	}
+	if m.RMSSD != 50 || m.PNN50 != 0 {
+		t.Fatalf("got RMSSD %v pNN50 %v, want 50 and 0", m.RMSSD, m.PNN50)
+	}
+}
+
+func TestComputeRejectsArtifacts(t *testing.T) {
+	rr := alternating(20, 800, 860)
+	// 超出生理范围的间期与孤立的异位搏动
+	rr[6] = 2500
+	rr[12] = 400
+	m, ok := Compute([][]int{rr})
+	if !ok {
+		t.Fatal("expected metrics")
+	}
+	if m.Artifacts != 2 || m.Beats != 18 {
+		t.Fatalf("got beats %d artifacts %d, want 18 and 2", m.Beats, m.Artifacts)
+	}
+	// 剔除的间期前后不计算差值，其余差值仍为 ±60
+	if m.RMSSD != 60 {
+		t.Fatalf("got RMSSD %v, want 60", m.RMSSD)
+	}
+}
+
+func TestComputeFollowsStepChange(t *testing.T) {
+	// 60 → 80 bpm：阶跃后的前几个间期被判为异位搏动，之后参考重新建立
+	rr := append(repeat(20, 1000), repeat(200, 750)...)
+	m, ok := Compute([][]int{rr})
+	if !ok {
+		t.Fatal("expected metrics")
+	}
+	if m.Artifacts != reseedBeats || m.Beats != 220-reseedBeats {
+		t.Fatalf("got beats %d artifacts %d, want %d and %d", m.Beats, m.Artifacts, 220-reseedBeats, reseedBeats)
+	}
+}
+
+func TestComputeResetsReferenceAtSegmentBoundary(t *testing.T) {
+	// 间隔之后心率已经不同，新序列不应以上一段的间期为参考
+	m, ok := Compute([][]int{repeat(20, 1000), repeat(20, 600)})
+	if !ok {
+		t.Fatal("expected metrics")
+	}
+	if m.Artifacts != 0 || m.Beats != 40 {
+		t.Fatalf("got beats %d artifacts %d, want 40 and 0", m.Beats, m.Artifacts)
+	}
+	// 差值不跨越序列边界
+	if m.RMSSD != 0 {
+		t.Fatalf("got RMSSD %v, want 0", m.RMSSD)
+	}
+}
+
+func TestComputeInsufficientBeats(t *testing.T) {
+	if _, ok := Compute([][]int{repeat(minBeats-1, 800)}); ok {
+		t.Fatal("expected no metrics with too few beats")
+	}
+}
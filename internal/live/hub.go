@@ -0,0 +1,216 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/storage"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	channelPrefix = "heart_rate_live"
+	// viewerBuffer 每个观看者的发送缓冲，慢速观看者会丢弃中间样本
+	viewerBuffer = 16
+)
+
+// Hub 跨实例分发实时心率。所有实例共用一条Redis订阅连接，
+// 只订阅本实例上有观看者的用户频道，最后一个观看者离开时退订
+type Hub struct {
+	Redis redis.UniversalClient
+
+	// subMu 串行化订阅和退订。订阅调用需要访问Redis，不在 mu 内进行
+	subMu   sync.Mutex
+	mu      sync.Mutex
+	pubsub  *redis.PubSub
+	viewers map[uint]map[chan models.HeartRateData]struct{}
+	closed  bool
+}
+
+func NewHub(client redis.UniversalClient) *Hub {
+	return &Hub{
+		Redis:   client,
+		viewers: make(map[uint]map[chan models.HeartRateData]struct{}),
+	}
+}
+
+func channelName(userID uint) string {
+	return storage.UserKey(channelPrefix, userID)
+}
+
+// parseChannel 从频道名 heart_rate_live:{42} 中解析用户ID
+func parseChannel(channel string) (uint, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(channel, channelPrefix+":{"), "}")
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// Run 建立共享订阅连接并分发消息，阻塞直到 ctx 结束
+func (h *Hub) Run(ctx context.Context) {
+	pubsub := h.Redis.Subscribe(ctx)
+	h.subMu.Lock()
+	h.mu.Lock()
+	h.pubsub = pubsub
+	// 连接建立前已有的观看者在此补订阅
+	channels := make([]string, 0, len(h.viewers))
+	for userID := range h.viewers {
+		channels = append(channels, channelName(userID))
+	}
+	h.mu.Unlock()
+
+	if len(channels) > 0 {
+		if err := pubsub.Subscribe(ctx, channels...); err != nil {
+			log.Printf("Failed to subscribe live channels: %v", err)
+		}
+	}
+	h.subMu.Unlock()
+
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			userID, ok := parseChannel(msg.Channel)
+			if !ok {
+				continue
+			}
+			var data models.HeartRateData
+			if err := json.Unmarshal([]byte(msg.Payload), &data); err != nil {
+				log.Printf("Invalid live message on %s: %v", msg.Channel, err)
+				continue
+			}
+			h.broadcast(userID, data)
+		}
+	}
+}
+
+// Publish 发布一条样本到所有实例，Redis不可用时至少投递给本实例的观看者
+func (h *Hub) Publish(ctx context.Context, userID uint, data models.HeartRateData) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := h.Redis.Publish(ctx, channelName(userID), payload).Err(); err != nil {
+		h.broadcast(userID, data)
+		return err
+	}
+	return nil
+}
+
+// Subscribe 注册一个观看者，返回样本通道和取消函数。
+// Hub 关闭时通道会被关闭
+func (h *Hub) Subscribe(ctx context.Context, userID uint) (<-chan models.HeartRateData, func()) {
+	ch := make(chan models.HeartRateData, viewerBuffer)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	set, watched := h.viewers[userID]
+	if !watched {
+		set = make(map[chan models.HeartRateData]struct{})
+		h.viewers[userID] = set
+	}
+	set[ch] = struct{}{}
+	h.mu.Unlock()
+
+	if !watched {
+		h.syncChannel(ctx, userID)
+	}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() { h.unsubscribe(userID, ch) })
+	}
+}
+
+func (h *Hub) unsubscribe(userID uint, ch chan models.HeartRateData) {
+	h.mu.Lock()
+	set, ok := h.viewers[userID]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	if _, ok := set[ch]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(set, ch)
+	close(ch)
+
+	last := len(set) == 0
+	if last {
+		delete(h.viewers, userID)
+	}
+	h.mu.Unlock()
+
+	if last {
+		h.syncChannel(context.Background(), userID)
+	}
+}
+
+// syncChannel 按用户当前是否有观看者订阅或退订其频道。
+// 并发的加入和离开按最新状态处理，不会因调用顺序留下错误的订阅状态
+func (h *Hub) syncChannel(ctx context.Context, userID uint) {
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+
+	h.mu.Lock()
+	_, watched := h.viewers[userID]
+	pubsub := h.pubsub
+	h.mu.Unlock()
+	if pubsub == nil {
+		return
+	}
+
+	if watched {
+		if err := pubsub.Subscribe(ctx, channelName(userID)); err != nil {
+			log.Printf("Failed to subscribe live channel for user %d: %v", userID, err)
+		}
+		return
+	}
+	if err := pubsub.Unsubscribe(context.Background(), channelName(userID)); err != nil {
+		log.Printf("Failed to unsubscribe live channel for user %d: %v", userID, err)
+	}
+}
+
+func (h *Hub) broadcast(userID uint, data models.HeartRateData) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.viewers[userID] {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+// Close 断开所有观看者，用于优雅停机时结束长连接
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for userID, set := range h.viewers {
+		for ch := range set {
+			close(ch)
+		}
+		delete(h.viewers, userID)
+	}
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+const (
+	// deviceInvalidateChannel 跨实例广播设备删除的频道
+	deviceInvalidateChannel = "device_invalidate"
+	deviceLocalTTL          = 30 * time.Second
+	// deviceTouchInterval 最后上报时间写入数据库的最小间隔，设备信息变化时立即写入
+	deviceTouchInterval = 30 * time.Second
+)
+
+// DeviceAuthMiddleware 校验设备令牌（Authorization: Bearer 或 X-Device-Token），
+// 写入 cached_user_id 和 device_id
+type DeviceAuthMiddleware struct {
+	DB    *gorm.DB
+	Redis redis.UniversalClient
+
+	local *lruCache[models.Device]
+}
+
+func NewDeviceAuthMiddleware(db *gorm.DB, redis redis.UniversalClient, localSize int) *DeviceAuthMiddleware {
+	return &DeviceAuthMiddleware{
+		DB:    db,
+		Redis: redis,
+		local: newLRUCache[models.Device](localSize),
+	}
+}
+
+// HashDeviceToken 设备令牌与分享令牌一样以SHA-256哈希保存
+func HashDeviceToken(token string) string {
+	return HashShareToken(token)
+}
+
+func deviceToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-Device-Token")
+}
+
+func (m *DeviceAuthMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := deviceToken(r)
+		if token == "" {
+			utils.SendError(w, http.StatusUnauthorized, nil, "Missing device token")
+			return
+		}
+
+		hash := HashDeviceToken(token)
+		device, err := m.resolve(r.Context(), hash)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				utils.SendError(w, http.StatusUnauthorized, nil, "Invalid device token")
+			} else {
+				utils.SendError(w, http.StatusInternalServerError, err, "Failed to resolve device")
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "cached_user_id", device.UserID)
+		ctx = context.WithValue(ctx, "device_id", device.ID)
+		ctx = context.WithValue(ctx, "device_token_hash", hash)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (m *DeviceAuthMiddleware) resolve(ctx context.Context, hash string) (models.Device, error) {
+	if device, ok := m.local.Get(hash); ok {
+		return device, nil
+	}
+
+	var device models.Device
+	if err := m.DB.WithContext(ctx).Where("token_hash = ?", hash).First(&device).Error; err != nil {
+		return device, err
+	}
+
+	m.local.Set(hash, device, deviceLocalTTL)
+	return device, nil
+}
+
+// Touch 记录设备的最后上报时间和设备信息。只有距上次写入超过 deviceTouchInterval
+// 或设备信息变化时才写数据库
+func (m *DeviceAuthMiddleware) Touch(ctx context.Context, hash string, meta *models.DeviceMetadata) error {
+	device, ok := m.local.Get(hash)
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{}
+	if device.LastSeenAt == nil || now.Sub(*device.LastSeenAt) >= deviceTouchInterval {
+		updates["last_seen_at"] = now
+		device.LastSeenAt = &now
+	}
+	if meta != nil {
+		if meta.Firmware != "" && meta.Firmware != device.Firmware {
+			updates["firmware"] = meta.Firmware
+			device.Firmware = meta.Firmware
+		}
+		if meta.Battery != nil && (device.Battery == nil || *meta.Battery != *device.Battery) {
+			updates["battery"] = *meta.Battery
+			device.Battery = meta.Battery
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	if err := m.DB.WithContext(ctx).Model(&models.Device{}).Where("id = ?", device.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	m.local.Replace(hash, device)
+	return nil
+}
+
+// Invalidate 清除已删除设备的缓存并通知其他实例
+func (m *DeviceAuthMiddleware) Invalidate(ctx context.Context, tokenHash string) error {
+	m.local.Delete(tokenHash)
+	return m.Redis.Publish(ctx, deviceInvalidateChannel, tokenHash).Err()
+}
+
+// Listen 订阅删除广播并清除本地缓存，阻塞直到 ctx 结束
+func (m *DeviceAuthMiddleware) Listen(ctx context.Context) {
+	pubsub := m.Redis.Subscribe(ctx, deviceInvalidateChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				log.Printf("Device invalidation subscription closed")
+				return
+			}
+			m.local.Delete(msg.Payload)
+		}
+	}
+}
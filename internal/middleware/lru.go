@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruEntry 本地缓存条目，value 的类型由各中间件决定
+type lruEntry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+// lruCache 带过期时间的进程内 LRU 缓存，并发安全
+type lruCache[V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+func newLRUCache[V any](capacity int) *lruCache[V] {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &lruCache[V]{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get 返回未过期的条目，过期条目会被顺带清除
+func (c *lruCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*lruEntry[V])
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		return zero, false
+	}
+	c.ll.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *lruCache[V]) Set(key string, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := lruEntry[V]{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	if elem, ok := c.items[key]; ok {
+		*elem.Value.(*lruEntry[V]) = entry
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry)
+	if c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Replace 更新仍在缓存中的条目，不改变过期时间，条目不存在或已过期时返回 false
+func (c *lruCache[V]) Replace(key string, value V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok || time.Now().After(elem.Value.(*lruEntry[V]).expiresAt) {
+		return false
+	}
+	elem.Value.(*lruEntry[V]).value = value
+	return true
+}
+
+func (c *lruCache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *lruCache[V]) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*lruEntry[V]).key)
+}
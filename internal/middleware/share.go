@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gorilla/mux"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+const (
+	// shareInvalidateChannel 跨实例广播分享链接撤销的频道
+	shareInvalidateChannel = "share_link_invalidate"
+	// 分享链接只在本地缓存很短时间，过期时间精确到请求
+	shareLocalTTL         = 30 * time.Second
+	shareLocalNegativeTTL = 10 * time.Second
+	// shareViewTTL 限制查看次数的链接每次打开页面签发的查看会话的有效期，不超过链接的过期时间
+	shareViewTTL = 12 * time.Hour
+)
+
+// AccessCheck 长连接（SSE）定期调用，返回 false 时说明访问凭据已过期、撤销或轮换，应关闭连接。
+// 由公开访问的中间件以 "access_check" 写入请求上下文
+type AccessCheck func(ctx context.Context) bool
+
+func shareViewKey(tokenHash, view string) string {
+	return "share_view:" + tokenHash + ":" + view
+}
+
+// shareEntry 分享链接的本地缓存，found 为 false 表示负缓存（链接不存在或已撤销）
+type shareEntry struct {
+	userID    uint
+	found     bool
+	expiresAt time.Time
+	// limited 链接设置了查看次数上限
+	limited bool
+}
+
+// ShareLinkMiddleware 把分享令牌解析为UserID，与 UUIDCacheMiddleware 一样写入 cached_user_id，
+// 后续使用与UUID相同的公开处理器
+type ShareLinkMiddleware struct {
+	DB    *gorm.DB
+	Redis redis.UniversalClient
+	local *lruCache[shareEntry]
+}
+
+func NewShareLinkMiddleware(db *gorm.DB, redis redis.UniversalClient, localSize int) *ShareLinkMiddleware {
+	return &ShareLinkMiddleware{
+		DB:    db,
+		Redis: redis,
+		local: newLRUCache[shareEntry](localSize),
+	}
+}
+
+// HashShareToken 分享令牌在数据库中以SHA-256哈希保存
+func HashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Handler 校验 {token} 路径参数，链接不存在、已撤销或已过期时返回404
+func (m *ShareLinkMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		token, ok := vars["token"]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hash := HashShareToken(token)
+		link, found, err := m.resolve(r.Context(), hash)
+		if err != nil {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to resolve share link")
+			return
+		}
+		if !found {
+			utils.SendError(w, http.StatusNotFound, nil, "Share link not found or expired")
+			return
+		}
+
+		view := vars["view"]
+		var check AccessCheck = func(ctx context.Context) bool {
+			return m.stillValid(ctx, hash, view)
+		}
+		ctx := context.WithValue(r.Context(), "cached_user_id", link.userID)
+		ctx = context.WithValue(ctx, "share_token_hash", hash)
+		ctx = context.WithValue(ctx, "share_limited", link.limited)
+		ctx = context.WithValue(ctx, "access_check", check)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireView 限制查看次数的链接，数据接口只接受 /s/{token}/v/{view}/... 形式的请求，
+// {view} 为打开页面时签发的查看会话，使查看次数上限对数据接口同样有效。不限次数的链接直接放行
+func (m *ShareLinkMiddleware) RequireView(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hash, _ := r.Context().Value("share_token_hash").(string)
+		if limited, _ := r.Context().Value("share_limited").(bool); !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		view := mux.Vars(r)["view"]
+		if view == "" {
+			utils.SendError(w, http.StatusForbidden, nil, "Open the share link page to view")
+			return
+		}
+		n, err := m.Redis.Exists(r.Context(), shareViewKey(hash, view)).Result()
+		if err != nil {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to verify share link view")
+			return
+		}
+		if n == 0 {
+			utils.SendError(w, http.StatusForbidden, nil, "Share link view expired, reopen the page")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CountView 把一次请求计为一次查看，超过次数上限时返回410。只用于组件页面；
+// 限制次数的链接同时签发查看会话（写入 share_view），页面之后的数据请求使用该会话而不再计数
+func (m *ShareLinkMiddleware) CountView(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hash, ok := r.Context().Value("share_token_hash").(string)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := m.DB.Model(&models.ShareLink{}).
+			Where("token_hash = ? AND expires_at > ? AND (max_views = 0 OR views < max_views)", hash, time.Now()).
+			UpdateColumn("views", gorm.Expr("views + 1"))
+		if result.Error != nil {
+			utils.SendError(w, http.StatusInternalServerError, result.Error, "Failed to update share link")
+			return
+		}
+		if result.RowsAffected == 0 {
+			utils.SendError(w, http.StatusGone, nil, "Share link view limit reached")
+			return
+		}
+
+		if limited, _ := r.Context().Value("share_limited").(bool); limited {
+			link, found, err := m.resolve(r.Context(), hash)
+			if err != nil || !found {
+				utils.SendError(w, http.StatusNotFound, err, "Share link not found or expired")
+				return
+			}
+			view, err := newViewID()
+			if err != nil {
+				utils.SendError(w, http.StatusInternalServerError, err, "Failed to create share link view")
+				return
+			}
+			ttl := min(shareViewTTL, time.Until(link.expiresAt))
+			if err := m.Redis.Set(r.Context(), shareViewKey(hash, view), 1, ttl).Err(); err != nil {
+				utils.SendError(w, http.StatusInternalServerError, err, "Failed to create share link view")
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), "share_view", view))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newViewID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// stillValid 链接仍然有效，并且限制次数时查看会话未过期。查询出错时不关闭连接
+func (m *ShareLinkMiddleware) stillValid(ctx context.Context, hash, view string) bool {
+	link, found, err := m.resolve(ctx, hash)
+	if err != nil {
+		return true
+	}
+	if !found || !time.Now().Before(link.expiresAt) {
+		return false
+	}
+	if !link.limited {
+		return true
+	}
+	n, err := m.Redis.Exists(ctx, shareViewKey(hash, view)).Result()
+	return err != nil || n > 0
+}
+
+// resolve 查询本地缓存或数据库，本地缓存的有效期不超过链接的过期时间
+func (m *ShareLinkMiddleware) resolve(ctx context.Context, hash string) (shareEntry, bool, error) {
+	if entry, ok := m.local.Get(hash); ok {
+		return entry, entry.found, nil
+	}
+
+	var link models.ShareLink
+	err := m.DB.WithContext(ctx).Select("user_id", "expires_at", "max_views").
+		Where("token_hash = ?", hash).First(&link).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			m.local.Set(hash, shareEntry{}, shareLocalNegativeTTL)
+			return shareEntry{}, false, nil
+		}
+		return shareEntry{}, false, err
+	}
+
+	remaining := time.Until(link.ExpiresAt)
+	if remaining <= 0 {
+		return shareEntry{}, false, nil
+	}
+	entry := shareEntry{userID: link.UserID, found: true, expiresAt: link.ExpiresAt, limited: link.MaxViews > 0}
+	m.local.Set(hash, entry, min(remaining, shareLocalTTL))
+	return entry, true, nil
+}
+
+// Invalidate 清除已撤销链接的缓存并通知其他实例
+func (m *ShareLinkMiddleware) Invalidate(ctx context.Context, tokenHash string) error {
+	m.local.Delete(tokenHash)
+	return m.Redis.Publish(ctx, shareInvalidateChannel, tokenHash).Err()
+}
+
+// Listen 订阅撤销广播并清除本地缓存，阻塞直到 ctx 结束
+func (m *ShareLinkMiddleware) Listen(ctx context.Context) {
+	pubsub := m.Redis.Subscribe(ctx, shareInvalidateChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				log.Printf("Share link invalidation subscription closed")
+				return
+			}
+			m.local.Delete(msg.Payload)
+		}
+	}
+}
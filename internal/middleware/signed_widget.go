@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSignature 签名链接格式错误、签名不匹配或已过期
+var ErrInvalidSignature = errors.New("invalid or expired widget signature")
+
+const (
+	// widgetSecretInvalidateChannel 跨实例广播签名密钥轮换的频道
+	widgetSecretInvalidateChannel = "widget_secret_invalidate"
+	widgetSecretLocalTTL          = 30 * time.Second
+)
+
+// signedPassthroughParams 签名中没有时可以从请求中附加的参数，只影响数据接口的响应格式
+var signedPassthroughParams = []string{"format"}
+
+// signedWidgetPayload 签名覆盖的内容：用户、组件参数与过期时间（Unix秒）
+type signedWidgetPayload struct {
+	UserID  uint   `json:"u"`
+	Query   string `json:"q"`
+	Expires int64  `json:"e"`
+}
+
+func signPayload(secret, encoded string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignWidgetToken 生成 "<载荷>.<HMAC>" 格式的令牌，载荷为 base64url 编码的JSON
+func SignWidgetToken(secret string, userID uint, query string, expires time.Time) (string, error) {
+	raw, err := json.Marshal(signedWidgetPayload{UserID: userID, Query: query, Expires: expires.Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	return encoded + "." + signPayload(secret, encoded), nil
+}
+
+// SignedWidgetMiddleware 校验签名组件链接 /w/{signed}。通过后请求参数替换为签名中的参数，
+// 只保留 signedPassthroughParams，使样式、延迟、回放范围等无法被篡改或追加，并写入 cached_user_id 供公开处理器使用。
+// 用户的签名密钥在本地缓存，轮换后通过 Invalidate 清除
+type SignedWidgetMiddleware struct {
+	DB    *gorm.DB
+	Redis redis.UniversalClient
+	// local 用户ID到签名密钥，用户不存在或未生成密钥时缓存空字符串
+	local *lruCache[string]
+}
+
+func NewSignedWidgetMiddleware(db *gorm.DB, redis redis.UniversalClient, localSize int) *SignedWidgetMiddleware {
+	return &SignedWidgetMiddleware{
+		DB:    db,
+		Redis: redis,
+		local: newLRUCache[string](localSize),
+	}
+}
+
+func (m *SignedWidgetMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := mux.Vars(r)["signed"]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		payload, err := m.verify(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, ErrInvalidSignature) {
+				utils.SendError(w, http.StatusForbidden, nil, "Invalid or expired widget link")
+			} else {
+				utils.SendError(w, http.StatusInternalServerError, err, "Failed to verify widget link")
+			}
+			return
+		}
+
+		signed, err := url.ParseQuery(payload.Query)
+		if err != nil {
+			utils.SendError(w, http.StatusForbidden, nil, "Invalid or expired widget link")
+			return
+		}
+		query := r.URL.Query()
+		for _, key := range signedPassthroughParams {
+			if _, ok := signed[key]; !ok && query.Has(key) {
+				signed[key] = query[key]
+			}
+		}
+		r.URL.RawQuery = signed.Encode()
+		// 长连接期间链接过期或密钥轮换后关闭
+		var check AccessCheck = func(ctx context.Context) bool {
+			_, err := m.verify(ctx, token)
+			return err == nil || !errors.Is(err, ErrInvalidSignature)
+		}
+		ctx := context.WithValue(r.Context(), "cached_user_id", payload.UserID)
+		ctx = context.WithValue(ctx, "access_check", check)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// verify 解析令牌并用用户当前的密钥校验签名
+func (m *SignedWidgetMiddleware) verify(ctx context.Context, token string) (*signedWidgetPayload, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	var payload signedWidgetPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if time.Now().Unix() >= payload.Expires {
+		return nil, ErrInvalidSignature
+	}
+
+	secret, err := m.secret(ctx, payload.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" || !hmac.Equal([]byte(sig), []byte(signPayload(secret, encoded))) {
+		return nil, ErrInvalidSignature
+	}
+	return &payload, nil
+}
+
+// secret 查询本地缓存或数据库，用户不存在或未生成密钥时返回空字符串
+func (m *SignedWidgetMiddleware) secret(ctx context.Context, userID uint) (string, error) {
+	key := strconv.FormatUint(uint64(userID), 10)
+	if secret, ok := m.local.Get(key); ok {
+		return secret, nil
+	}
+
+	var user models.User
+	err := m.DB.WithContext(ctx).Select("id", "widget_secret").First(&user, userID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	m.local.Set(key, user.WidgetSecret, widgetSecretLocalTTL)
+	return user.WidgetSecret, nil
+}
+
+// Invalidate 清除用户签名密钥的缓存并通知其他实例，生成、轮换密钥或删除账户后调用
+func (m *SignedWidgetMiddleware) Invalidate(ctx context.Context, userID uint) error {
+	key := strconv.FormatUint(uint64(userID), 10)
+	m.local.Delete(key)
+	return m.Redis.Publish(ctx, widgetSecretInvalidateChannel, key).Err()
+}
+
+// Listen 订阅密钥轮换广播并清除本地缓存，阻塞直到 ctx 结束
+func (m *SignedWidgetMiddleware) Listen(ctx context.Context) {
+	pubsub := m.Redis.Subscribe(ctx, widgetSecretInvalidateChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				log.Printf("Widget secret invalidation subscription closed")
+				return
+			}
+			m.local.Delete(msg.Payload)
+		}
+	}
+}
@@ -6,25 +6,54 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/utils"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
+const (
+	// uuidInvalidateChannel 跨实例广播UUID失效的频道
+	uuidInvalidateChannel = "uuid_cache_invalidate"
+	// negativeCacheValue Redis中表示UUID不存在的占位值
+	negativeCacheValue = "null"
+
+	redisPositiveTTL = time.Hour
+	redisNegativeTTL = 5 * time.Minute
+	// 本地缓存TTL较短，即使错过失效广播也能尽快收敛
+	localPositiveTTL = time.Minute
+	localNegativeTTL = 30 * time.Second
+)
+
+// uuidEntry UUID的本地缓存，found 为 false 表示负缓存（UUID 不存在）
+type uuidEntry struct {
+	userID uint
+	found  bool
+}
+
+// UUIDCacheMiddleware 两级缓存（进程内LRU + Redis）解析UUID到UserID
 type UUIDCacheMiddleware struct {
 	DB    *gorm.DB
-	Redis *redis.Client
+	Redis redis.UniversalClient
+	local *lruCache[uuidEntry]
 }
 
-func NewUUIDCacheMiddleware(db *gorm.DB, redis *redis.Client) *UUIDCacheMiddleware {
+func NewUUIDCacheMiddleware(db *gorm.DB, redis redis.UniversalClient, localSize int) *UUIDCacheMiddleware {
 	return &UUIDCacheMiddleware{
 		DB:    db,
 		Redis: redis,
+		local: newLRUCache[uuidEntry](localSize),
 	}
 }
 
+func uuidCacheKey(uuid string) string {
+	return fmt.Sprintf("uuid_to_user_id:%s", uuid)
+}
+
 // Handler 缓存UUID到UserID的映射
 func (m *UUIDCacheMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -36,36 +65,86 @@ func (m *UUIDCacheMiddleware) Handler(next http.Handler) http.Handler {
 			return
 		}
 
-		ctx := r.Context()
-		cacheKey := fmt.Sprintf("uuid_to_user_id:%s", uuid)
-
-		// 1. 尝试从缓存获取
-		var userID uint
-		if cachedID, err := m.Redis.Get(ctx, cacheKey).Uint64(); err == nil {
-			userID = uint(cachedID)
-			ctx = context.WithValue(ctx, "cached_user_id", userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+		userID, found, err := m.Resolve(r.Context(), uuid)
+		if err != nil {
+			utils.SendError(w, http.StatusInternalServerError, err, "Failed to resolve user")
 			return
 		}
-
-		// 2. 缓存未命中，查询数据库
-		var user struct {
-			ID uint
-		}
-		if err := m.DB.Model(&models.User{}).Select("id").Where("uuid = ?", uuid).First(&user).Error; err != nil {
-			// 缓存空结果防止穿透
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				m.Redis.Set(ctx, cacheKey, "null", 5*time.Minute)
-			}
-			next.ServeHTTP(w, r)
+		if !found {
+			utils.SendError(w, http.StatusNotFound, nil, "User not found")
 			return
 		}
 
-		// 3. 写入缓存
-		userID = user.ID
-		m.Redis.Set(ctx, cacheKey, userID, time.Hour)
-		ctx = context.WithValue(ctx, "cached_user_id", userID)
-
+		ctx := context.WithValue(r.Context(), "cached_user_id", userID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// Resolve 依次查询本地缓存、Redis和数据库，found 为 false 表示UUID不存在
+func (m *UUIDCacheMiddleware) Resolve(ctx context.Context, uuid string) (uint, bool, error) {
+	// 1. 进程内缓存
+	if entry, ok := m.local.Get(uuid); ok {
+		return entry.userID, entry.found, nil
+	}
+
+	// 2. Redis缓存，出错时直接回源数据库
+	cacheKey := uuidCacheKey(uuid)
+	if cached, err := m.Redis.Get(ctx, cacheKey).Result(); err == nil {
+		if cached == negativeCacheValue {
+			m.local.Set(uuid, uuidEntry{}, localNegativeTTL)
+			return 0, false, nil
+		}
+		if id, err := strconv.ParseUint(cached, 10, 64); err == nil {
+			m.local.Set(uuid, uuidEntry{userID: uint(id), found: true}, localPositiveTTL)
+			return uint(id), true, nil
+		}
+	}
+
+	// 3. 查询数据库
+	var user struct {
+		ID uint
+	}
+	if err := m.DB.Model(&models.User{}).Select("id").Where("uuid = ?", uuid).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, false, err
+		}
+		// 缓存空结果防止穿透
+		m.Redis.Set(ctx, cacheKey, negativeCacheValue, redisNegativeTTL)
+		m.local.Set(uuid, uuidEntry{}, localNegativeTTL)
+		return 0, false, nil
+	}
+
+	// 4. 写入缓存
+	m.Redis.Set(ctx, cacheKey, user.ID, redisPositiveTTL)
+	m.local.Set(uuid, uuidEntry{userID: user.ID, found: true}, localPositiveTTL)
+	return user.ID, true, nil
+}
+
+// Invalidate 清除UUID的缓存并通知其他实例，在UUID变更或用户删除后调用
+func (m *UUIDCacheMiddleware) Invalidate(ctx context.Context, uuid string) error {
+	m.local.Delete(uuid)
+	if err := m.Redis.Del(ctx, uuidCacheKey(uuid)).Err(); err != nil {
+		return err
+	}
+	return m.Redis.Publish(ctx, uuidInvalidateChannel, uuid).Err()
+}
+
+// Listen 订阅失效广播并清除本地缓存，阻塞直到 ctx 结束
+func (m *UUIDCacheMiddleware) Listen(ctx context.Context) {
+	pubsub := m.Redis.Subscribe(ctx, uuidInvalidateChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				log.Printf("UUID cache invalidation subscription closed")
+				return
+			}
+			m.local.Delete(msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 告警规则类型
+const (
+	// AlertTypeAbove 心率持续 Duration 秒高于 Threshold
+	AlertTypeAbove = "above"
+	// AlertTypeAverageBelow 最近 Duration 秒的平均心率低于 Threshold
+	AlertTypeAverageBelow = "average_below"
+	// AlertTypeJump 最近 Duration 秒内心率变化达到 Threshold
+	AlertTypeJump = "jump"
+	// AlertTypeNoData 超过 Duration 秒没有上报数据
+	AlertTypeNoData = "no_data"
+)
+
+// 告警规则状态与告警记录的状态
+const (
+	AlertStateOK       = "ok"
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// AlertRule 用户的告警规则。触发后心率需要越过 Threshold 再回退 Hysteresis 才恢复，
+// 恢复后 Cooldown 秒内不会再次触发
+type AlertRule struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"size:50;not null"`
+	Type       string `gorm:"size:20;index;not null"`
+	Threshold  int
+	Duration   int `gorm:"not null"`
+	Hysteresis int
+	Cooldown   int
+	Enabled    bool
+	State      string `gorm:"size:10;not null;default:ok"`
+	// LastFiredAt 最近一次触发的时间
+	LastFiredAt *time.Time
+	// LastResolvedAt 最近一次恢复的时间，冷却从此时开始计算
+	LastResolvedAt *time.Time
+}
+
+// AlertRuleRequest 创建或修改规则，Hysteresis、Cooldown、Enabled 省略时使用默认值（5、300、true）
+type AlertRuleRequest struct {
+	Name       string `json:"name" validate:"required,max=50"`
+	Type       string `json:"type" validate:"required,oneof=above average_below jump no_data"`
+	Threshold  int    `json:"threshold" validate:"omitempty,min=1,max=250"`
+	Duration   int    `json:"duration" validate:"required,min=1,max=86400"`
+	Hysteresis *int   `json:"hysteresis" validate:"omitempty,min=0,max=50"`
+	Cooldown   *int   `json:"cooldown" validate:"omitempty,min=0,max=86400"`
+	Enabled    *bool  `json:"enabled"`
+}
+
+type AlertRuleResponse struct {
+	ID             uint   `json:"id"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Threshold      int    `json:"threshold"`
+	Duration       int    `json:"duration"`
+	Hysteresis     int    `json:"hysteresis"`
+	Cooldown       int    `json:"cooldown"`
+	Enabled        bool   `json:"enabled"`
+	State          string `json:"state"`
+	LastFiredAt    int64  `json:"last_fired_at,omitempty"`
+	LastResolvedAt int64  `json:"last_resolved_at,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+}
+
+// AlertEvent 告警记录，规则触发和恢复时各写入一条。Value 为触发或恢复时的观测值：
+// 心率、平均心率、变化幅度或未上报的秒数
+type AlertEvent struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"index:idx_alert_event_user_time;not null"`
+	RuleID    uint   `gorm:"not null"`
+	RuleName  string `gorm:"size:50"`
+	Type      string `gorm:"size:20"`
+	State     string `gorm:"size:10;not null"`
+	Value     float64
+	Threshold int
+	CreatedAt time.Time `gorm:"index:idx_alert_event_user_time"`
+}
+
+type AlertEventResponse struct {
+	ID        uint    `json:"id"`
+	RuleID    uint    `json:"rule_id"`
+	RuleName  string  `json:"rule_name"`
+	Type      string  `json:"type"`
+	State     string  `json:"state"`
+	Value     float64 `json:"value"`
+	Threshold int     `json:"threshold"`
+	CreatedAt int64   `json:"created_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+// CustomWidget 用户上传的自定义组件模板，保存原始内容，渲染时再清理
+type CustomWidget struct {
+	gorm.Model
+	UserID uint   `gorm:"uniqueIndex;not null"`
+	HTML   string `gorm:"type:text"`
+	CSS    string `gorm:"type:text"`
+}
+
+type CustomWidgetRequest struct {
+	HTML string `json:"html" form:"html"`
+	CSS  string `json:"css" form:"css"`
+}
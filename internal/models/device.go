@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 设备类型
+const (
+	DeviceTypeWatch      = "watch"
+	DeviceTypeChestStrap = "chest_strap"
+	DeviceTypePhone      = "phone"
+	DeviceTypeOther      = "other"
+)
+
+// Device 用户登记的上报设备，每个设备使用独立的令牌上报，数据库中只保存令牌哈希。
+// 多个设备同时上报时 Priority 数值小的优先
+type Device struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"size:50;not null"`
+	Type       string `gorm:"size:20;not null"`
+	TokenHash  string `gorm:"uniqueIndex;size:64;not null"`
+	Priority   int    `gorm:"not null;default:0"`
+	LastSeenAt *time.Time
+	Firmware   string `gorm:"size:50"`
+	Battery    *int
+}
+
+type CreateDeviceRequest struct {
+	Name     string `json:"name" validate:"required,max=50"`
+	Type     string `json:"type" validate:"required,oneof=watch chest_strap phone other"`
+	Priority int    `json:"priority" validate:"min=0,max=100"`
+}
+
+type UpdateDeviceRequest struct {
+	Name     string `json:"name" validate:"required,max=50"`
+	Priority int    `json:"priority" validate:"min=0,max=100"`
+}
+
+// DeviceMetadata 设备随样本上报的可选信息
+type DeviceMetadata struct {
+	Firmware string `json:"firmware" validate:"max=50"`
+	Battery  *int   `json:"battery" validate:"omitempty,min=0,max=100"`
+}
+
+// DeviceReportRequest 设备上报请求，在样本之外可附带设备信息
+type DeviceReportRequest struct {
+	HeartRateData
+	Device *DeviceMetadata `json:"device"`
+}
+
+type DeviceResponse struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Priority   int    `json:"priority"`
+	LastSeenAt int64  `json:"last_seen_at,omitempty"`
+	Firmware   string `json:"firmware,omitempty"`
+	Battery    *int   `json:"battery,omitempty"`
+	CreatedAt  int64  `json:"created_at"`
+	// Token 只在创建时返回
+	Token string `json:"token,omitempty"`
+}
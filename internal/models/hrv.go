@@ -0,0 +1,21 @@
+package models
+
+// HRVMetrics 时域心率变异性指标。RMSSD、SDNN、MeanRR 单位为毫秒，PNN50 为百分比
+type HRVMetrics struct {
+	RMSSD     float64 `json:"rmssd"`
+	SDNN      float64 `json:"sdnn"`
+	PNN50     float64 `json:"pnn50"`
+	MeanRR    float64 `json:"mean_rr"`
+	Beats     int     `json:"beats"`
+	Artifacts int     `json:"artifacts"`
+	// WindowMs 计算使用的时间窗口
+	WindowMs int64 `json:"window_ms"`
+}
+
+// HRVResponse 一个时间窗口内的心率变异性，DeviceID 为提供逐搏间期的设备
+type HRVResponse struct {
+	From     int64 `json:"from"`
+	To       int64 `json:"to"`
+	DeviceID uint  `json:"device_id,omitempty"`
+	HRVMetrics
+}
@@ -0,0 +1,42 @@
+package models
+
+import "gorm.io/gorm"
+
+// 公开接口的数据精度
+const (
+	// PrivacyModeExact 公开精确心率
+	PrivacyModeExact = "exact"
+	// PrivacyModeRounded 心率按 Bucket 取整后公开
+	PrivacyModeRounded = "rounded"
+	// PrivacyModeZone 只公开心率区间名称
+	PrivacyModeZone = "zone"
+)
+
+// PrivacyWindow 允许公开查看的时间段，Start/End 为 "HH:MM"。
+// End 早于 Start 时跨越午夜；Days 为星期（0为周日），按 Start 所在的日期判断，为空表示每天
+type PrivacyWindow struct {
+	Days  []int  `json:"days" validate:"max=7,dive,min=0,max=6"`
+	Start string `json:"start" validate:"required,len=5"`
+	End   string `json:"end" validate:"required,len=5"`
+}
+
+// PrivacyOptions 公开接口的隐私设置，通过认证的接口不受影响
+type PrivacyOptions struct {
+	PublicEnabled bool   `json:"public_enabled"`
+	Mode          string `json:"mode" validate:"required,oneof=exact rounded zone"`
+	// Bucket 取整模式的步长（次/分）
+	Bucket int `json:"bucket" validate:"omitempty,min=2,max=50"`
+	// Timezone IANA时区名称，用于判断 Schedule，为空时使用UTC
+	Timezone string `json:"timezone" validate:"max=64"`
+	// Schedule 为空表示任何时间都允许公开查看
+	Schedule []PrivacyWindow `json:"schedule" validate:"max=20,dive"`
+	// RequireSignedWidgets 开启后 /uuid 下的组件页面拒绝访问，组件只能通过签名链接或分享链接打开
+	RequireSignedWidgets bool `json:"require_signed_widgets"`
+}
+
+// PrivacySettings 用户的隐私设置，没有记录时使用默认值（公开、精确）
+type PrivacySettings struct {
+	gorm.Model
+	UserID  uint           `gorm:"uniqueIndex;not null"`
+	Options PrivacyOptions `gorm:"serializer:json"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "gorm.io/gorm"
+
+// 心率区间的计算方式
+const (
+	// ZoneMethodPercentMax 区间边界为最大心率的百分比
+	ZoneMethodPercentMax = "percent_max"
+	// ZoneMethodKarvonen 区间边界为储备心率（最大心率-静息心率）的百分比，再加上静息心率
+	ZoneMethodKarvonen = "karvonen"
+)
+
+// HeartRateProfile 计算心率区间使用的个人资料。MaxHR、RestingHR 为空时由年龄或默认值推算；
+// Boundaries 为第1至5区间下限的百分比，低于第1区间为静息，为空时使用默认值
+type HeartRateProfile struct {
+	Age        int    `json:"age,omitempty" validate:"omitempty,min=10,max=100"`
+	MaxHR      int    `json:"max_hr,omitempty" validate:"omitempty,min=100,max=250"`
+	RestingHR  int    `json:"resting_hr,omitempty" validate:"omitempty,min=30,max=120"`
+	Method     string `json:"method" validate:"required,oneof=percent_max karvonen"`
+	Boundaries []int  `json:"boundaries,omitempty" validate:"omitempty,len=5,dive,min=1,max=100"`
+}
+
+// UserProfile 用户的个人资料，没有记录时使用默认值
+type UserProfile struct {
+	gorm.Model
+	UserID  uint             `gorm:"uniqueIndex;not null"`
+	Profile HeartRateProfile `gorm:"serializer:json"`
+}
+
+// HeartRateZone 一个心率区间，Min 包含在内，Max 不包含，最高区间的 Max 为0
+type HeartRateZone struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Min   int    `json:"min"`
+	Max   int    `json:"max"`
+}
+
+// ProfileResponse 个人资料以及据此计算出的心率区间
+type ProfileResponse struct {
+	HeartRateProfile
+	EffectiveMaxHR     int             `json:"effective_max_hr"`
+	EffectiveRestingHR int             `json:"effective_resting_hr"`
+	Zones              []HeartRateZone `json:"zones"`
+}
@@ -0,0 +1,50 @@
+package models
+
+// HeartRateSample 归档到数据库的心率样本，超出Redis窗口后用于回放
+type HeartRateSample struct {
+	ID         uint  `gorm:"primarykey"`
+	UserID     uint  `gorm:"uniqueIndex:idx_heart_rate_sample_user_time;not null"`
+	MeasuredAt int64 `gorm:"uniqueIndex:idx_heart_rate_sample_user_time;index;not null"`
+	HeartRate  int   `gorm:"not null"`
+	DeviceID   uint
+}
+
+// ReplayState 回放进度。Position 为录制时间轴上的位置（毫秒时间戳），
+// 播放中时从 UpdatedAt 起按 Speed 倍速前进
+type ReplayState struct {
+	From      int64   `json:"from"`
+	To        int64   `json:"to"`
+	Speed     float64 `json:"speed"`
+	Playing   bool    `json:"playing"`
+	Position  int64   `json:"position"`
+	UpdatedAt int64   `json:"updated_at"`
+}
+
+// ReplaySession 保存在Redis中的回放会话，控制接口需要与 TokenHash 匹配的令牌
+type ReplaySession struct {
+	ID        string `json:"id"`
+	UserID    uint   `json:"user_id"`
+	TokenHash string `json:"token_hash"`
+	ReplayState
+}
+
+type CreateReplayRequest struct {
+	From  int64   `json:"from" validate:"required"`
+	To    int64   `json:"to" validate:"required,gtfield=From"`
+	Speed float64 `json:"speed"`
+}
+
+type CreateReplayResponse struct {
+	ID           string      `json:"id"`
+	ControlToken string      `json:"control_token"`
+	WidgetURL    string      `json:"widget_url"`
+	State        ReplayState `json:"state"`
+}
+
+// ReplayControlRequest 回放控制：play / pause / seek，seek 时 Position 为目标时间戳，
+// Speed 不为0时同时修改倍速
+type ReplayControlRequest struct {
+	Action   string  `json:"action" validate:"required,oneof=play pause seek"`
+	Position int64   `json:"position"`
+	Speed    float64 `json:"speed"`
+}
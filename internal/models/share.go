@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ShareLink 限时分享链接，只保存令牌的哈希。MaxViews 为0表示不限次数，
+// 打开一次组件页面计为一次查看
+type ShareLink struct {
+	gorm.Model
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;size:64;not null"`
+	Label     string    `gorm:"size:50"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	MaxViews  int       `gorm:"not null;default:0"`
+	Views     int       `gorm:"not null;default:0"`
+}
+
+type CreateShareLinkRequest struct {
+	Label string `json:"label" validate:"max=50"`
+	// ExpiresIn 有效期（秒）
+	ExpiresIn int `json:"expires_in" validate:"required,min=60,max=2592000"`
+	MaxViews  int `json:"max_views" validate:"min=0"`
+}
+
+// ShareLinkResponse 分享链接信息，Token 和 URL 只在创建时返回
+type ShareLinkResponse struct {
+	ID        uint   `json:"id"`
+	Label     string `json:"label"`
+	ExpiresAt int64  `json:"expires_at"`
+	MaxViews  int    `json:"max_views"`
+	Views     int    `json:"views"`
+	CreatedAt int64  `json:"created_at"`
+	Token     string `json:"token,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// SignWidgetRequest 签名组件链接请求。Style 为空时使用默认样式，
+// Query 为组件参数（如 "delay=30&size=80"），ExpiresIn 为有效期（秒）
+type SignWidgetRequest struct {
+	Style     string `json:"style"`
+	Query     string `json:"query"`
+	ExpiresIn int    `json:"expires_in" validate:"required,min=60,max=31536000"`
+}
+
+type SignWidgetResponse struct {
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expires_at"`
+}
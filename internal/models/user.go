@@ -11,6 +11,8 @@ type User struct {
 	Username string `gorm:"unique;not null"`
 	Password string `gorm:"not null"`
 	UUID     string `gorm:"uniqueIndex;size:36"`
+	// WidgetSecret 签名组件链接的密钥，轮换后此前签发的链接全部失效
+	WidgetSecret string `gorm:"size:64"`
 }
 
 type AuthInfo struct {
@@ -29,16 +31,69 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// SampleExtras 样本的可选附加数据，旧客户端可以不提供。
+// RRIntervals 为逐搏间期（毫秒），EnergyExpended 为BLE心率设备上报的累计能量消耗（千焦）
+type SampleExtras struct {
+	RRIntervals    []int `json:"rr_intervals,omitempty" validate:"max=60,dive,min=200,max=3000"`
+	SpO2           *int  `json:"spo2,omitempty" validate:"omitempty,min=50,max=100"`
+	Battery        *int  `json:"battery,omitempty" validate:"omitempty,min=0,max=100"`
+	SensorContact  *bool `json:"sensor_contact,omitempty"`
+	EnergyExpended *int  `json:"energy_expended,omitempty" validate:"omitempty,min=0,max=65535"`
+}
+
+// HeartRateReading 一次测量的数据
+type HeartRateReading struct {
+	HeartRate int `json:"heart_rate" validate:"required,min=1,max=250"`
+	SampleExtras
+}
+
 type HeartRateData struct {
-	Data struct {
-		HeartRate int `json:"heart_rate" validate:"required,min=1,max=250"`
-	} `json:"data"`
-	MeasuredAt int64 `json:"measured_at" validate:"required"`
+	Data       HeartRateReading `json:"data"`
+	MeasuredAt int64            `json:"measured_at" validate:"required"`
+	// DeviceID 上报设备，通过账户或UUID上报的样本为0
+	DeviceID uint `json:"device_id,omitempty"`
 }
 
+// 心率数据状态，由服务端根据数据年龄计算
+const (
+	HeartRateStatusLive    = "live"
+	HeartRateStatusStale   = "stale"
+	HeartRateStatusOffline = "offline"
+)
+
 type HeartRateDataResponse struct {
+	HeartRate  int    `json:"heart_rate"`
+	MeasuredAt int64  `json:"measured_at"`
+	AgeMs      int64  `json:"age_ms"`
+	Status     string `json:"status"`
+	// ZoneIndex、ZoneName 按用户个人资料计算的心率区间，0为低于第1区间
+	ZoneIndex int    `json:"zone_index"`
+	ZoneName  string `json:"zone_name"`
+	DeviceID  uint   `json:"device_id,omitempty"`
+	SampleExtras
+	// HRV 最近一段时间的心率变异性，逐搏间期不足时为空
+	HRV *HRVMetrics `json:"hrv,omitempty"`
+}
+
+type HeartRatePoint struct {
 	HeartRate  int   `json:"heart_rate"`
 	MeasuredAt int64 `json:"measured_at"`
+	DeviceID   uint  `json:"device_id,omitempty"`
+	SampleExtras
+}
+
+// HeartRateHistoryResponse 一段时间内的样本及统计，没有样本时统计值为0
+type HeartRateHistoryResponse struct {
+	From    int64            `json:"from"`
+	To      int64            `json:"to"`
+	Min     int              `json:"min"`
+	Max     int              `json:"max"`
+	Avg     float64          `json:"avg"`
+	Samples []HeartRatePoint `json:"samples"`
 }
 
 type Response struct {
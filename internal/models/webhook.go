@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook事件
+const (
+	// WebhookEventSample 收到一条心率样本
+	WebhookEventSample = "sample.received"
+	// WebhookEventStreamStarted 间隔超过离线阈值后收到的第一条样本
+	WebhookEventStreamStarted = "stream.started"
+	// WebhookEventAlertFired、WebhookEventAlertResolved 心率类告警规则触发与恢复
+	WebhookEventAlertFired    = "alert.fired"
+	WebhookEventAlertResolved = "alert.resolved"
+	// WebhookEventDataStopped、WebhookEventDataResumed 未上报规则触发与恢复
+	WebhookEventDataStopped = "data.stopped"
+	WebhookEventDataResumed = "data.resumed"
+	// WebhookEventPing 手动发送的测试事件，不需要订阅
+	WebhookEventPing = "ping"
+)
+
+// Webhook请求体格式。聊天平台格式发送一条文字消息，模板格式由用户的 text/template 生成
+const (
+	WebhookFormatGeneric  = "generic"
+	WebhookFormatDiscord  = "discord"
+	WebhookFormatSlack    = "slack"
+	WebhookFormatTelegram = "telegram"
+	WebhookFormatFeishu   = "feishu"
+	WebhookFormatTemplate = "template"
+)
+
+// 投递记录的状态
+const (
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryRetrying  = "retrying"
+	WebhookDeliveryDead      = "dead"
+)
+
+// Webhook 用户登记的事件接收地址。Secret 用于HMAC-SHA256签名，只在创建和轮换时返回
+type Webhook struct {
+	gorm.Model
+	UserID  uint     `gorm:"index;not null"`
+	URL     string   `gorm:"size:2048;not null"`
+	Secret  string   `gorm:"size:64;not null"`
+	Events  []string `gorm:"serializer:json"`
+	Enabled bool
+	// Format 为空等同于 generic；Template 只在 template 格式下使用
+	Format   string `gorm:"size:16;not null;default:generic"`
+	Template string `gorm:"size:4096"`
+}
+
+// WebhookRequest 创建或修改Webhook，Enabled 省略时为 true，Format 省略时为 generic
+type WebhookRequest struct {
+	URL      string   `json:"url" validate:"required,url,max=2048"`
+	Events   []string `json:"events" validate:"required,min=1,max=6,dive,oneof=sample.received stream.started alert.fired alert.resolved data.stopped data.resumed"`
+	Enabled  *bool    `json:"enabled"`
+	Format   string   `json:"format" validate:"omitempty,oneof=generic discord slack telegram feishu template"`
+	Template string   `json:"template" validate:"max=4096"`
+}
+
+type WebhookResponse struct {
+	ID        uint     `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Enabled   bool     `json:"enabled"`
+	Format    string   `json:"format"`
+	Template  string   `json:"template,omitempty"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+// WebhookDelivery 每次投递尝试的记录
+type WebhookDelivery struct {
+	ID         uint   `gorm:"primarykey"`
+	WebhookID  uint   `gorm:"index:idx_webhook_delivery_time;not null"`
+	EventID    string `gorm:"size:32;not null"`
+	Event      string `gorm:"size:32;not null"`
+	Attempt    int
+	Status     string `gorm:"size:10;not null"`
+	StatusCode int
+	Error      string `gorm:"size:255"`
+	DurationMs int64
+	CreatedAt  time.Time `gorm:"index:idx_webhook_delivery_time;index"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID         uint   `json:"id"`
+	EventID    string `json:"event_id"`
+	Event      string `json:"event"`
+	Attempt    int    `json:"attempt"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// WebhookPayload 投递的请求体，重试时 ID 不变，接收方可据此去重
+type WebhookPayload struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt int64           `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "gorm.io/gorm"
+
+// WidgetOptions 心率展示组件的外观配置
+type WidgetOptions struct {
+	HeartColor string `json:"heart_color"`
+	TextColor  string `json:"text_color"`
+	Background string `json:"background"`
+	Font       string `json:"font"`
+	Size       int    `json:"size"`
+	Animate    bool   `json:"animate"`
+	Label      string `json:"label"`
+	Align      string `json:"align"`
+	// Minutes 趋势图显示的时间范围（分钟）
+	Minutes int `json:"minutes"`
+	// Delay 数据相对实时延迟的秒数，与有延迟的直播画面对齐
+	Delay int `json:"delay"`
+	// ZoneColors 按心率区间改变心形颜色，代替 HeartColor，默认关闭
+	ZoneColors bool `json:"zone_colors"`
+}
+
+// WidgetPreset 用户保存的组件外观预设
+type WidgetPreset struct {
+	gorm.Model
+	UserID  uint          `gorm:"uniqueIndex:idx_widget_preset_user_name;not null"`
+	Name    string        `gorm:"uniqueIndex:idx_widget_preset_user_name;size:50;not null"`
+	Options WidgetOptions `gorm:"serializer:json"`
+}
+
+type WidgetPresetResponse struct {
+	Name    string        `json:"name"`
+	Options WidgetOptions `json:"options"`
+}
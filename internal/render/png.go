@@ -0,0 +1,232 @@
+// Package render 以纯Go光栅化生成心率图片，不依赖外部服务或系统字体
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Theme 图片配色
+type Theme struct {
+	Background color.RGBA
+	Text       color.RGBA
+	Muted      color.RGBA
+	Line       color.RGBA
+}
+
+// Themes 可选主题
+var Themes = map[string]Theme{
+	"dark": {
+		Background: color.RGBA{R: 0x1b, G: 0x1b, B: 0x1f, A: 0xff},
+		Text:       color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		Muted:      color.RGBA{R: 0x9f, G: 0x9f, B: 0xa8, A: 0xff},
+		Line:       color.RGBA{R: 0xf2, G: 0x00, B: 0x44, A: 0xff},
+	},
+	"light": {
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		Text:       color.RGBA{R: 0x1b, G: 0x1b, B: 0x1f, A: 0xff},
+		Muted:      color.RGBA{R: 0x6e, G: 0x6e, B: 0x78, A: 0xff},
+		Line:       color.RGBA{R: 0xd0, G: 0x00, B: 0x3a, A: 0xff},
+	},
+	"transparent": {
+		Text:  color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		Muted: color.RGBA{R: 0xdd, G: 0xdd, B: 0xdd, A: 0xff},
+		Line:  color.RGBA{R: 0xf2, G: 0x00, B: 0x44, A: 0xff},
+	},
+}
+
+// Point 趋势图上的一个样本
+type Point struct {
+	HeartRate  int
+	MeasuredAt int64
+}
+
+// Image 图片内容。HeartRate 为0时显示 Status；From/To 为趋势图的时间范围（毫秒），
+// Chart 为 nil 时不绘制趋势图
+type Image struct {
+	Width, Height int
+	Theme         Theme
+	HeartRate     int
+	Status        string
+	Chart         []Point
+	From, To      int64
+}
+
+var (
+	fontsOnce sync.Once
+	boldFont  *opentype.Font
+	textFont  *opentype.Font
+	fontsErr  error
+)
+
+// face 返回指定字号的字体。字体文件只解析一次，
+// Face 不能并发使用，因此每次绘制单独创建
+func face(bold bool, size int) (font.Face, error) {
+	fontsOnce.Do(func() {
+		if boldFont, fontsErr = opentype.Parse(gobold.TTF); fontsErr != nil {
+			return
+		}
+		textFont, fontsErr = opentype.Parse(goregular.TTF)
+	})
+	if fontsErr != nil {
+		return nil, fontsErr
+	}
+
+	src := textFont
+	if bold {
+		src = boldFont
+	}
+	return opentype.NewFace(src, &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingFull})
+}
+
+// PNG 绘制图片并以PNG编码写出
+func PNG(w io.Writer, img Image) error {
+	canvas := image.NewRGBA(image.Rect(0, 0, img.Width, img.Height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(img.Theme.Background), image.Point{}, draw.Src)
+
+	// 有趋势图时数值占上部，否则垂直居中
+	textArea := img.Height
+	if img.Chart != nil {
+		textArea = img.Height * 45 / 100
+	}
+	padding := img.Height / 12
+	if padding < 4 {
+		padding = 4
+	}
+
+	size := textArea * 7 / 10
+	value, unit := strconv.Itoa(img.HeartRate), "BPM"
+	if img.HeartRate == 0 {
+		value, unit = img.Status, ""
+		size = textArea * 4 / 10
+	}
+	big, err := face(true, size)
+	if err != nil {
+		return err
+	}
+	defer big.Close()
+	small, err := face(false, size*2/5)
+	if err != nil {
+		return err
+	}
+	defer small.Close()
+
+	baseline := (textArea + size*7/10) / 2
+	x := drawText(canvas, big, img.Theme.Text, padding, baseline, value)
+	if unit != "" {
+		drawText(canvas, small, img.Theme.Muted, x+size/6, baseline, unit)
+	}
+
+	if img.Chart != nil {
+		drawChart(canvas, image.Rect(padding, textArea, img.Width-padding, img.Height-padding), img)
+	}
+
+	return png.Encode(w, canvas)
+}
+
+// drawText 在基线 (x, y) 处绘制文本，返回结束位置的横坐标
+func drawText(dst draw.Image, f font.Face, c color.RGBA, x, y int, text string) int {
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: f,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+	return d.Dot.X.Round()
+}
+
+// drawChart 绘制折线和半透明填充，纵轴按样本范围留出余量
+func drawChart(dst *image.RGBA, area image.Rectangle, img Image) {
+	if len(img.Chart) < 2 || area.Dx() <= 0 || area.Dy() <= 0 || img.To <= img.From {
+		return
+	}
+
+	low, high := img.Chart[0].HeartRate, img.Chart[0].HeartRate
+	for _, p := range img.Chart {
+		low = min(low, p.HeartRate)
+		high = max(high, p.HeartRate)
+	}
+	low -= 5
+	high += 5
+
+	px := func(t int64) float64 {
+		return float64(area.Min.X) + float64(t-img.From)/float64(img.To-img.From)*float64(area.Dx())
+	}
+	py := func(v int) float64 {
+		return float64(area.Max.Y) - float64(v-low)/float64(high-low)*float64(area.Dy())
+	}
+
+	// 逐列填充到底部，再描出折线
+	fill := img.Theme.Line
+	fill.A = 0x40
+	for i := 1; i < len(img.Chart); i++ {
+		x0, y0 := px(img.Chart[i-1].MeasuredAt), py(img.Chart[i-1].HeartRate)
+		x1, y1 := px(img.Chart[i].MeasuredAt), py(img.Chart[i].HeartRate)
+		for x := int(math.Ceil(x0)); x < int(math.Ceil(x1)); x++ {
+			y := y0
+			if x1 > x0 {
+				y = y0 + (y1-y0)*(float64(x)-x0)/(x1-x0)
+			}
+			blendRect(dst, image.Rect(x, int(y), x+1, area.Max.Y), fill)
+		}
+	}
+
+	thickness := float64(area.Dy()) / 40
+	if thickness < 1.5 {
+		thickness = 1.5
+	}
+	for i := 1; i < len(img.Chart); i++ {
+		drawLine(dst,
+			px(img.Chart[i-1].MeasuredAt), py(img.Chart[i-1].HeartRate),
+			px(img.Chart[i].MeasuredAt), py(img.Chart[i].HeartRate),
+			thickness, img.Theme.Line)
+	}
+}
+
+// drawLine 沿线段按半像素步长绘制圆点，得到指定粗细的线
+func drawLine(dst *image.RGBA, x0, y0, x1, y1, thickness float64, c color.RGBA) {
+	steps := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))*2) + 1
+	r := thickness / 2
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		cx, cy := x0+(x1-x0)*t, y0+(y1-y0)*t
+		for y := int(cy - r); y <= int(cy+r); y++ {
+			for x := int(cx - r); x <= int(cx+r); x++ {
+				if (float64(x)+0.5-cx)*(float64(x)+0.5-cx)+(float64(y)+0.5-cy)*(float64(y)+0.5-cy) <= r*r {
+					setOpaque(dst, x, y, c)
+				}
+			}
+		}
+	}
+}
+
+func setOpaque(dst *image.RGBA, x, y int, c color.RGBA) {
+	if image.Pt(x, y).In(dst.Bounds()) {
+		dst.SetRGBA(x, y, c)
+	}
+}
+
+func blendRect(dst *image.RGBA, r image.Rectangle, c color.RGBA) {
+	// 预乘Alpha后以 Over 方式叠加
+	a := uint32(c.A)
+	src := color.RGBA{
+		R: uint8(uint32(c.R) * a / 0xff),
+		G: uint8(uint32(c.G) * a / 0xff),
+		B: uint8(uint32(c.B) * a / 0xff),
+		A: c.A,
+	}
+	draw.Draw(dst, r.Intersect(dst.Bounds()), image.NewUniform(src), image.Point{}, draw.Over)
+}
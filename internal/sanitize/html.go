@@ -0,0 +1,138 @@
+package sanitize
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedElements 允许保留的元素，其余元素去掉标签只保留内容
+var allowedElements = map[string]bool{
+	"div": true, "span": true, "p": true, "section": true, "header": true, "footer": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"b": true, "i": true, "strong": true, "em": true, "small": true, "sup": true, "sub": true,
+	"ul": true, "ol": true, "li": true, "br": true, "hr": true, "img": true,
+}
+
+// droppedElements 连同内容一起删除的元素
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "template": true, "noscript": true,
+	"form": true, "input": true, "button": true, "textarea": true, "select": true,
+	"link": true, "meta": true, "base": true, "title": true, "svg": true, "math": true,
+}
+
+var voidElements = map[string]bool{"br": true, "hr": true, "img": true}
+
+var globalAttributes = map[string]bool{"class": true, "id": true, "title": true, "style": true}
+
+var imgAttributes = map[string]bool{"src": true, "alt": true, "width": true, "height": true}
+
+// Placeholders 模板中可使用的占位符，如 {{bpm}}
+var Placeholders = []string{"bpm", "zone", "status", "age"}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(` + strings.Join(Placeholders, "|") + `)\s*\}\}`)
+
+var cssForbiddenPattern = regexp.MustCompile(`(?i)(@import|expression\s*\(|javascript\s*:|vbscript\s*:|behaviou?r\s*:|-moz-binding|</|<!--)`)
+
+// HTML 按白名单清理用户上传的标记，并把占位符替换为 <span data-field="..."></span>。
+// 输出只由白名单元素和转义后的文本组成，不包含任何脚本或事件属性
+func HTML(input string) (string, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(input), context)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		writeNode(&b, n)
+	}
+	return b.String(), nil
+}
+
+// CSS 去除可导入外部资源或执行脚本的CSS结构，并防止提前结束 <style> 元素
+func CSS(input string) string {
+	// 反复替换直到稳定，防止 "@imp@importort" 这类拼接绕过
+	for {
+		cleaned := cssForbiddenPattern.ReplaceAllString(input, "")
+		if cleaned == input {
+			return cleaned
+		}
+		input = cleaned
+	}
+}
+
+func writeNode(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		writeText(b, n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	tag := strings.ToLower(n.Data)
+	if droppedElements[tag] {
+		return
+	}
+	if !allowedElements[tag] {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeNode(b, c)
+		}
+		return
+	}
+
+	b.WriteString("<" + tag)
+	for _, attr := range n.Attr {
+		if value, ok := sanitizeAttribute(tag, attr); ok {
+			b.WriteString(" " + strings.ToLower(attr.Key) + `="` + html.EscapeString(value) + `"`)
+		}
+	}
+	b.WriteString(">")
+	if voidElements[tag] {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeNode(b, c)
+	}
+	b.WriteString("</" + tag + ">")
+}
+
+func sanitizeAttribute(tag string, attr html.Attribute) (string, bool) {
+	if attr.Namespace != "" {
+		return "", false
+	}
+	key := strings.ToLower(attr.Key)
+	switch {
+	case key == "style":
+		return CSS(attr.Val), true
+	case globalAttributes[key]:
+		return attr.Val, true
+	case tag == "img" && key == "src":
+		// 只允许站内静态资源和内联图片
+		src := strings.TrimSpace(attr.Val)
+		if strings.HasPrefix(src, "/static/") || strings.HasPrefix(strings.ToLower(src), "data:image/") {
+			return src, true
+		}
+		return "", false
+	case tag == "img" && imgAttributes[key]:
+		return attr.Val, true
+	default:
+		return "", false
+	}
+}
+
+// writeText 转义文本并把占位符替换为由前端脚本填充的元素
+func writeText(b *strings.Builder, text string) {
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(html.EscapeString(text[last:m[0]]))
+		b.WriteString(`<span data-field="` + text[m[2]:m[3]] + `"></span>`)
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+}
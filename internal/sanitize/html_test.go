@@ -0,0 +1,74 @@
+package sanitize
+
+import "testing"
+
+func TestHTML(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"allowed element", `<div class="a"><b>hi</b></div>`, `<div class="a"><b>hi</b></div>`},
+		{"script removed", `<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+		{"style element removed", `<style>body{color:red}</style><p>x</p>`, `<p>x</p>`},
+		{"svg removed", `<svg><script>alert(1)</script><circle r="1"/></svg>ok`, `ok`},
+		{"math removed", `<math><mi xlink:href="javascript:alert(1)">x</mi></math>ok`, `ok`},
+		{"template removed", `<template><img src=x onerror=alert(1)></template>ok`, `ok`},
+		{"iframe removed", `<iframe src="https://example.com"></iframe>ok`, `ok`},
+		{"unknown element unwrapped", `<a href="javascript:alert(1)">link</a>`, `link`},
+		{"event handlers dropped", `<div onclick="alert(1)" onmouseover="x()">a</div>`, `<div>a</div>`},
+		{"uppercase event handler dropped", `<p ONLOAD="alert(1)">a</p>`, `<p>a</p>`},
+		{"unknown attribute dropped", `<span data-x="1" hidden>a</span>`, `<span>a</span>`},
+		{"javascript img src rejected", `<img src="javascript:alert(1)" alt="a">`, `<img alt="a">`},
+		{"remote img src rejected", `<img src="https://evil.example/t.png">`, `<img>`},
+		{"protocol relative img src rejected", `<img src="//evil.example/t.png">`, `<img>`},
+		{"static img src kept", `<img src="/static/heart.png" width="10">`, `<img src="/static/heart.png" width="10">`},
+		{"data img src kept", `<img src="data:image/png;base64,AAAA">`, `<img src="data:image/png;base64,AAAA">`},
+		{"img attributes only on img", `<div src="/static/a.png" alt="a">x</div>`, `<div>x</div>`},
+		{"attribute value escaped", `<div title='"><script>'>x</div>`, `<div title="&#34;&gt;&lt;script&gt;">x</div>`},
+		{"inline style sanitized", `<div style="background:url(x);width:expression(alert(1))">x</div>`, `<div style="background:url(x);width:alert(1))">x</div>`},
+		{"text escaped", `1 < 2 & "3"`, `1 &lt; 2 &amp; &#34;3&#34;`},
+		{"comment removed", `a<!-- <script>alert(1)</script> -->b`, `ab`},
+		{"placeholder", `<b>{{bpm}}</b> BPM`, `<b><span data-field="bpm"></span></b> BPM`},
+		{"placeholder with spaces", `{{ zone }}/{{status}}`, `<span data-field="zone"></span>/<span data-field="status"></span>`},
+		{"unknown placeholder kept as text", `{{secret}}`, `{{secret}}`},
+		{"placeholder in attribute not substituted", `<div title="{{bpm}}">x</div>`, `<div title="{{bpm}}">x</div>`},
+		{"placeholder around escaped text", `<{{age}}>`, `&lt;<span data-field="age"></span>&gt;`},
+	}
+	for _, tc := range cases {
+		got, err := HTML(tc.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: HTML(%q) = %q, want %q", tc.name, tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestCSS(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain rules kept", `.a { color: #fff; }`, `.a { color: #fff; }`},
+		{"import removed", `@import url(https://evil.example/x.css); .a{}`, ` url(https://evil.example/x.css); .a{}`},
+		{"import case insensitive", `@IMPORT "x.css";`, ` "x.css";`},
+		{"split import", `@imp@importort "x.css";`, ` "x.css";`},
+		{"expression removed", `.a { width: expression(alert(1)); }`, `.a { width: alert(1)); }`},
+		{"expression with spaces", `.a { width: EXPRESSION  (alert(1)); }`, `.a { width: alert(1)); }`},
+		{"split expression", `.a { width: expexpression(ression(alert(1)); }`, `.a { width: alert(1)); }`},
+		{"javascript url", `.a { background: url(javascript:alert(1)); }`, `.a { background: url(alert(1)); }`},
+		{"behavior", `.a { behavior: url(x.htc); }`, `.a {  url(x.htc); }`},
+		{"moz binding", `.a { -moz-binding: url(x.xml#y); }`, `.a { : url(x.xml#y); }`},
+		{"closing style tag", `.a{}</style><script>alert(1)</script>`, `.a{}style><script>alert(1)script>`},
+		{"split closing tag", `.a{}<<//style>`, `.a{}style>`},
+		{"comment opener", `<!-- .a{} -->`, ` .a{} -->`},
+	}
+	for _, tc := range cases {
+		if got := CSS(tc.input); got != tc.want {
+			t.Errorf("%s: CSS(%q) = %q, want %q", tc.name, tc.input, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"heart-rate-server/internal/models"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// archiveBatchSize 每次写入数据库的最大样本数
+	archiveBatchSize = 500
+	// archivePruneInterval 清理过期归档的间隔
+	archivePruneInterval = time.Hour
+)
+
+// SampleArchive 把样本长期保存到数据库，供超出Redis窗口的回放使用。
+// 样本先进入内存队列，由 Run 批量写入，避免上报请求等待数据库
+type SampleArchive struct {
+	DB *gorm.DB
+	// Retention 归档保留时长，0 表示不归档
+	Retention time.Duration
+
+	// flushMu 在写入期间持有，删除用户归档时等待正在写入的批次完成
+	flushMu  sync.Mutex
+	mu       sync.Mutex
+	queue    []models.HeartRateSample
+	maxQueue int
+}
+
+func NewSampleArchive(db *gorm.DB, retention time.Duration, queueSize int) *SampleArchive {
+	return &SampleArchive{
+		DB:        db,
+		Retention: retention,
+		maxQueue:  queueSize,
+	}
+}
+
+// Enabled 是否启用了归档
+func (a *SampleArchive) Enabled() bool {
+	return a.Retention > 0
+}
+
+// Add 把样本加入写入队列，队列满时丢弃最旧的样本
+func (a *SampleArchive) Add(userID uint, data models.HeartRateData) {
+	if !a.Enabled() {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.queue) >= a.maxQueue {
+		a.queue = a.queue[1:]
+		log.Printf("Heart rate archive queue is full, dropping oldest sample")
+	}
+	a.queue = append(a.queue, models.HeartRateSample{
+		UserID:     userID,
+		MeasuredAt: data.MeasuredAt,
+		HeartRate:  data.Data.HeartRate,
+		DeviceID:   data.DeviceID,
+	})
+}
+
+// Range 返回 [from, to] 毫秒时间范围内按时间升序排列的归档样本
+func (a *SampleArchive) Range(ctx context.Context, userID uint, from, to int64) ([]models.HeartRateData, error) {
+	var rows []models.HeartRateSample
+	err := a.DB.WithContext(ctx).
+		Where("user_id = ? AND measured_at BETWEEN ? AND ?", userID, from, to).
+		Order("measured_at").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]models.HeartRateData, len(rows))
+	for i, row := range rows {
+		samples[i].Data.HeartRate = row.HeartRate
+		samples[i].MeasuredAt = row.MeasuredAt
+		samples[i].DeviceID = row.DeviceID
+	}
+	return samples, nil
+}
+
+// Run 定期写入队列中的样本并清理过期归档，阻塞直到 ctx 结束，退出前写入剩余样本
+func (a *SampleArchive) Run(ctx context.Context) {
+	if !a.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.flush(context.Background())
+			return
+		case <-ticker.C:
+			a.flush(ctx)
+			if time.Since(lastPrune) >= archivePruneInterval {
+				a.prune(ctx)
+				lastPrune = time.Now()
+			}
+		}
+	}
+}
+
+func (a *SampleArchive) flush(ctx context.Context) {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	for {
+		a.mu.Lock()
+		n := len(a.queue)
+		if n > archiveBatchSize {
+			n = archiveBatchSize
+		}
+		batch := make([]models.HeartRateSample, n)
+		copy(batch, a.queue[:n])
+		a.mu.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+		// 缓冲回放等情况下可能重复上报同一样本，按用户和测量时间去重
+		err := a.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&batch).Error
+		if err != nil {
+			log.Printf("Failed to archive heart rate samples: %v", err)
+			return
+		}
+
+		a.mu.Lock()
+		a.queue = a.queue[len(batch):]
+		a.mu.Unlock()
+	}
+}
+
+// Delete 删除用户的归档，包括队列中尚未写入的样本
+func (a *SampleArchive) Delete(ctx context.Context, userID uint) error {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	a.mu.Lock()
+	a.queue = slices.DeleteFunc(a.queue, func(sample models.HeartRateSample) bool {
+		return sample.UserID == userID
+	})
+	a.mu.Unlock()
+
+	return a.DB.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.HeartRateSample{}).Error
+}
+
+func (a *SampleArchive) prune(ctx context.Context) {
+	cutoff := time.Now().Add(-a.Retention).UnixNano() / int64(time.Millisecond)
+	result := a.DB.WithContext(ctx).Where("measured_at < ?", cutoff).Delete(&models.HeartRateSample{})
+	if result.Error != nil {
+		log.Printf("Failed to prune heart rate archive: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Pruned %d archived heart rate samples", result.RowsAffected)
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrCircuitOpen 熔断器打开期间直接拒绝Redis调用
+var ErrCircuitOpen = errors.New("redis circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker 以 redis.Hook 的形式挂在客户端上，连续失败达到阈值后打开，
+// 冷却时间过后放行一个试探请求，成功则关闭
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+}
+
+var _ redis.Hook = (*CircuitBreaker)(nil)
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow 判断是否放行请求，半开状态下只放行一个试探请求
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// 调用方取消的请求说明不了Redis是否可用，半开状态下重新放行一个试探请求
+	if errors.Is(err, context.Canceled) {
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+		return
+	}
+	if !isAvailabilityError(err) {
+		if b.state != breakerClosed {
+			log.Printf("Redis recovered, circuit breaker closed")
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			log.Printf("Redis unavailable, circuit breaker opened: %v", err)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// isAvailabilityError 只有连接类错误才计入失败，redis.Nil 和服务端返回的错误不算
+func isAvailabilityError(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+func (b *CircuitBreaker) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, b.allow()
+}
+
+func (b *CircuitBreaker) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if errors.Is(cmd.Err(), ErrCircuitOpen) {
+		return nil
+	}
+	b.record(cmd.Err())
+	return nil
+}
+
+func (b *CircuitBreaker) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, b.allow()
+}
+
+func (b *CircuitBreaker) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); isAvailabilityError(cmdErr) {
+			err = cmdErr
+			break
+		}
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return nil
+	}
+	b.record(err)
+	return nil
+}
@@ -9,12 +9,24 @@ import (
 )
 
 func InitDB(cfg *config.Config) (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(cfg.DBDSN), &gorm.Config{})
+	var db *gorm.DB
+	err := retryWithBackoff("Database", cfg.StartupRetryAttempts, cfg.StartupRetryMaxDelay, func() error {
+		var err error
+		db, err = gorm.Open(sqlite.Open(cfg.DBDSN), &gorm.Config{})
+		if err != nil {
+			return err
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Ping()
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect database: %v", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.WidgetPreset{}, &models.CustomWidget{}, &models.HeartRateSample{}, &models.ShareLink{}, &models.PrivacySettings{}, &models.Device{}, &models.UserProfile{}, &models.AlertRule{}, &models.AlertEvent{}, &models.Webhook{}, &models.WebhookDelivery{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %v", err)
 	}
 
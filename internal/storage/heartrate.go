@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"heart-rate-server/internal/models"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrNoData 没有可用的心率数据
+	ErrNoData = errors.New("no heart rate data")
+	// ErrBufferFull Redis不可用且内存缓冲区已满
+	ErrBufferFull = errors.New("heart rate buffer is full")
+)
+
+// replayBatchSize 每次回放写入Redis的最大样本数
+const replayBatchSize = 500
+
+type pendingSample struct {
+	userID uint
+	data   models.HeartRateData
+	ttl    time.Duration
+}
+
+// HeartRateStore 心率数据存储。Redis不可用时把样本暂存在有界内存缓冲区，
+// 恢复后按序回放；期间最新数据由内存提供
+type HeartRateStore struct {
+	Redis redis.UniversalClient
+	// Window 每个用户保留的样本时间窗口，更早的样本在写入时被清理
+	Window time.Duration
+
+	// replayMu 在回放期间持有，删除用户数据时等待正在写入的批次完成
+	replayMu   sync.Mutex
+	mu         sync.Mutex
+	pending    []pendingSample
+	maxPending int
+	latest     map[uint]models.HeartRateData
+}
+
+func NewHeartRateStore(client redis.UniversalClient, bufferSize int, window time.Duration) *HeartRateStore {
+	return &HeartRateStore{
+		Redis:      client,
+		Window:     window,
+		maxPending: bufferSize,
+		latest:     make(map[uint]models.HeartRateData),
+	}
+}
+
+// Save 写入一条样本，Redis失败时转入缓冲区，仅在缓冲区满时返回错误
+func (s *HeartRateStore) Save(ctx context.Context, userID uint, data models.HeartRateData, ttl time.Duration) error {
+	s.rememberLatest(userID, data)
+
+	if err := s.write(ctx, []pendingSample{{userID: userID, data: data, ttl: ttl}}); err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if len(s.pending) >= s.maxPending {
+			return ErrBufferFull
+		}
+		s.pending = append(s.pending, pendingSample{userID: userID, data: data, ttl: ttl})
+		return nil
+	}
+	return nil
+}
+
+// Latest 返回用户最新的样本，Redis不可用时退回内存中的最新值
+func (s *HeartRateStore) Latest(ctx context.Context, userID uint) (*models.HeartRateData, error) {
+	result, err := s.Redis.ZRevRangeWithScores(ctx, heartRateKey(userID), 0, 0).Result()
+	if err != nil {
+		if cached, ok := s.cachedLatest(userID); ok {
+			return &cached, nil
+		}
+		return nil, err
+	}
+
+	cached, hasCached := s.cachedLatest(userID)
+	if len(result) == 0 {
+		if hasCached && s.hasPending() {
+			return &cached, nil
+		}
+		return nil, ErrNoData
+	}
+
+	var data models.HeartRateData
+	if err := json.Unmarshal([]byte(result[0].Member.(string)), &data); err != nil {
+		return nil, err
+	}
+
+	// 缓冲区中可能有尚未回放的更新样本
+	if hasCached && cached.MeasuredAt > data.MeasuredAt && s.hasPending() {
+		return &cached, nil
+	}
+	return &data, nil
+}
+
+// LatestBefore 返回测量时间不晚于 at（毫秒）的最后一条样本，用于直播延迟
+func (s *HeartRateStore) LatestBefore(ctx context.Context, userID uint, at int64) (*models.HeartRateData, error) {
+	members, err := s.Redis.ZRevRangeByScore(ctx, heartRateKey(userID), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(at, 10),
+		Count: 1,
+	}).Result()
+	if err != nil && !s.hasPending() {
+		return nil, err
+	}
+
+	var latest *models.HeartRateData
+	if len(members) > 0 {
+		var data models.HeartRateData
+		if err := json.Unmarshal([]byte(members[0]), &data); err != nil {
+			return nil, err
+		}
+		latest = &data
+	}
+
+	s.mu.Lock()
+	for _, sample := range s.pending {
+		if sample.userID != userID || sample.data.MeasuredAt > at {
+			continue
+		}
+		if latest == nil || sample.data.MeasuredAt > latest.MeasuredAt {
+			data := sample.data
+			latest = &data
+		}
+	}
+	s.mu.Unlock()
+
+	if latest == nil {
+		return nil, ErrNoData
+	}
+	return latest, nil
+}
+
+// Range 返回 [from, to] 毫秒时间范围内按时间升序排列的样本，包含尚未回放的缓冲样本
+func (s *HeartRateStore) Range(ctx context.Context, userID uint, from, to int64) ([]models.HeartRateData, error) {
+	members, err := s.Redis.ZRangeByScore(ctx, heartRateKey(userID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from, 10),
+		Max: strconv.FormatInt(to, 10),
+	}).Result()
+	if err != nil && !s.hasPending() {
+		return nil, err
+	}
+
+	samples := make([]models.HeartRateData, 0, len(members))
+	seen := make(map[int64]bool, len(members))
+	for _, member := range members {
+		var data models.HeartRateData
+		if err := json.Unmarshal([]byte(member), &data); err != nil {
+			continue
+		}
+		samples = append(samples, data)
+		seen[data.MeasuredAt] = true
+	}
+
+	s.mu.Lock()
+	for _, sample := range s.pending {
+		at := sample.data.MeasuredAt
+		if sample.userID == userID && at >= from && at <= to && !seen[at] {
+			samples = append(samples, sample.data)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].MeasuredAt < samples[j].MeasuredAt
+	})
+	return samples, nil
+}
+
+// Delete 删除用户的全部心率数据，包括缓冲区中尚未回放的样本
+func (s *HeartRateStore) Delete(ctx context.Context, userID uint) error {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	delete(s.latest, userID)
+	s.pending = slices.DeleteFunc(s.pending, func(sample pendingSample) bool {
+		return sample.userID == userID
+	})
+	s.mu.Unlock()
+
+	return s.Redis.Del(ctx, heartRateKey(userID)).Err()
+}
+
+// Run 定期把缓冲区回放到Redis，并清理内存中过期的最新值，阻塞直到 ctx 结束
+func (s *HeartRateStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.replay(ctx)
+			s.evictLatest()
+		}
+	}
+}
+
+func (s *HeartRateStore) replay(ctx context.Context) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	n := len(s.pending)
+	if n > replayBatchSize {
+		n = replayBatchSize
+	}
+	batch := make([]pendingSample, n)
+	copy(batch, s.pending[:n])
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	err := s.write(ctx, batch)
+	// 服务端返回的错误（如 OOM、WRONGTYPE）重试也不会成功，丢弃这一批，避免阻塞后面的样本
+	var redisErr redis.Error
+	if err != nil && !errors.As(err, &redisErr) {
+		return
+	}
+
+	s.mu.Lock()
+	s.pending = s.pending[len(batch):]
+	remaining := len(s.pending)
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Dropped %d buffered heart rate samples rejected by Redis, %d remaining: %v", len(batch), remaining, err)
+		return
+	}
+	log.Printf("Replayed %d buffered heart rate samples to Redis, %d remaining", len(batch), remaining)
+}
+
+func (s *HeartRateStore) write(ctx context.Context, samples []pendingSample) error {
+	cutoff := strconv.FormatInt(time.Now().Add(-s.Window).UnixNano()/int64(time.Millisecond), 10)
+
+	pipe := s.Redis.TxPipeline()
+	for _, sample := range samples {
+		jsonData, err := json.Marshal(sample.data)
+		if err != nil {
+			return err
+		}
+		key := heartRateKey(sample.userID)
+		pipe.ZAdd(ctx, key, &redis.Z{
+			Score:  float64(sample.data.MeasuredAt),
+			Member: jsonData,
+		})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff)
+		pipe.Expire(ctx, key, sample.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *HeartRateStore) rememberLatest(userID uint, data models.HeartRateData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.latest[userID]; !ok || data.MeasuredAt >= current.MeasuredAt {
+		s.latest[userID] = data
+	}
+}
+
+func (s *HeartRateStore) cachedLatest(userID uint) (models.HeartRateData, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.latest[userID]
+	return data, ok
+}
+
+func (s *HeartRateStore) hasPending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.pending) > 0
+}
+
+// evictLatest 清理超过30分钟未更新的内存最新值，与Redis中最长的过期时间一致
+func (s *HeartRateStore) evictLatest() {
+	cutoff := time.Now().Add(-30*time.Minute).UnixNano() / int64(time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID, data := range s.latest {
+		if data.MeasuredAt < cutoff {
+			delete(s.latest, userID)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package storage
+
+import "fmt"
+
+// UserKey 生成按用户划分的Redis键。用户ID放在 hash tag 中，
+// 保证 Cluster 模式下同一用户的所有键落在同一个 slot，可在一个事务管道中操作
+func UserKey(prefix string, userID uint) string {
+	return fmt.Sprintf("%s:{%d}", prefix, userID)
+}
+
+func heartRateKey(userID uint) string {
+	return UserKey("heart_rate", userID)
+}
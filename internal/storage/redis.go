@@ -2,27 +2,93 @@ package storage
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"heart-rate-server/internal/config"
+	"os"
 
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
-func InitRedis(cfg *config.Config) (*redis.Client, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisAddr,
-		Password: cfg.RedisPassword,
-		DB:       cfg.RedisDB,
-	})
+func InitRedis(cfg *config.Config) (redis.UniversalClient, error) {
+	tlsConfig, err := redisTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var client redis.UniversalClient
+	switch cfg.RedisMode {
+	case config.RedisModeSentinel:
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.RedisMasterName,
+			SentinelAddrs:    cfg.RedisAddrs,
+			SentinelPassword: cfg.RedisSentinelPassword,
+			Username:         cfg.RedisUsername,
+			Password:         cfg.RedisPassword,
+			DB:               cfg.RedisDB,
+			TLSConfig:        tlsConfig,
+		})
+	case config.RedisModeCluster:
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.RedisAddrs,
+			Username:  cfg.RedisUsername,
+			Password:  cfg.RedisPassword,
+			TLSConfig: tlsConfig,
+		})
+	default:
+		client = redis.NewClient(&redis.Options{
+			Addr:      cfg.RedisAddr,
+			Username:  cfg.RedisUsername,
+			Password:  cfg.RedisPassword,
+			DB:        cfg.RedisDB,
+			TLSConfig: tlsConfig,
+		})
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	err = retryWithBackoff("Redis", cfg.StartupRetryAttempts, cfg.StartupRetryMaxDelay, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 
-	if _, err := client.Ping(ctx).Result(); err != nil {
+		_, err := client.Ping(ctx).Result()
+		return err
+	})
+	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
 	}
 
+	// 启动成功后再挂载熔断器，避免启动重试把熔断器打开
+	client.AddHook(NewCircuitBreaker(cfg.RedisBreakerThreshold, cfg.RedisBreakerCooldown))
+
 	return client, nil
 }
+
+// redisTLSConfig 未启用TLS时返回 nil
+func redisTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if !cfg.RedisTLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.RedisTLSServerName,
+		InsecureSkipVerify: cfg.RedisTLSInsecureSkipVerify,
+	}
+
+	if cfg.RedisTLSCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.RedisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no valid certificates in Redis CA file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
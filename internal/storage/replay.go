@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"heart-rate-server/internal/models"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// ErrReplayNotFound 回放会话不存在或已过期
+var ErrReplayNotFound = errors.New("replay session not found")
+
+// ReplayStore 在Redis中保存回放会话，多个实例共享播放状态
+type ReplayStore struct {
+	Redis redis.UniversalClient
+	TTL   time.Duration
+}
+
+func NewReplayStore(client redis.UniversalClient, ttl time.Duration) *ReplayStore {
+	return &ReplayStore{Redis: client, TTL: ttl}
+}
+
+func replayKey(id string) string {
+	return "replay_session:" + id
+}
+
+// userReplaysKey 用户的回放会话ID集合，删除账户时据此清除会话
+func userReplaysKey(userID uint) string {
+	return UserKey("replay_sessions", userID)
+}
+
+func hashReplayToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create 创建暂停在起点的回放会话，返回会话和明文控制令牌，令牌只保存哈希
+func (s *ReplayStore) Create(ctx context.Context, userID uint, state models.ReplayState) (*models.ReplaySession, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	session := &models.ReplaySession{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		TokenHash:   hashReplayToken(token),
+		ReplayState: state,
+	}
+	if err := s.Save(ctx, session); err != nil {
+		return nil, "", err
+	}
+	return session, token, nil
+}
+
+// Get 读取回放会话
+func (s *ReplayStore) Get(ctx context.Context, id string) (*models.ReplaySession, error) {
+	value, err := s.Redis.Get(ctx, replayKey(id)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrReplayNotFound
+		}
+		return nil, err
+	}
+
+	var session models.ReplaySession
+	if err := json.Unmarshal([]byte(value), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Save 保存会话并刷新有效期，用户的会话集合一同刷新
+func (s *ReplayStore) Save(ctx context.Context, session *models.ReplaySession) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	_, err = s.Redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, replayKey(session.ID), value, s.TTL)
+		pipe.SAdd(ctx, userReplaysKey(session.UserID), session.ID)
+		pipe.Expire(ctx, userReplaysKey(session.UserID), s.TTL)
+		return nil
+	})
+	return err
+}
+
+// DeleteUser 删除用户的全部回放会话
+func (s *ReplayStore) DeleteUser(ctx context.Context, userID uint) error {
+	ids, err := s.Redis.SMembers(ctx, userReplaysKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	// 会话键不在同一个哈希槽，逐个删除
+	for _, id := range ids {
+		if err := s.Redis.Del(ctx, replayKey(id)).Err(); err != nil {
+			return err
+		}
+	}
+	return s.Redis.Del(ctx, userReplaysKey(userID)).Err()
+}
+
+// CheckReplayToken 以常量时间比较控制令牌
+func CheckReplayToken(session *models.ReplaySession, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(session.TokenHash), []byte(hashReplayToken(token))) == 1
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+// retryWithBackoff 以指数退避重试 fn，直到成功或用完 attempts 次
+func retryWithBackoff(name string, attempts int, maxDelay time.Duration, fn func() error) error {
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	delay := time.Second
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if i == attempts {
+			break
+		}
+
+		log.Printf("%s not ready (attempt %d/%d): %v, retrying in %v", name, i, attempts, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"fmt"
+	"heart-rate-server/internal/models"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// 支持的响应格式
+const (
+	FormatJSON    = "json"
+	FormatText    = "text"
+	FormatCSV     = "csv"
+	FormatMsgpack = "msgpack"
+)
+
+// formatTypes 各格式对应的媒体类型，按优先级排列
+var formatTypes = []struct {
+	format    string
+	mediaType string
+}{
+	{FormatJSON, "application/json"},
+	{FormatText, "text/plain"},
+	{FormatCSV, "text/csv"},
+	{FormatMsgpack, "application/msgpack"},
+	{FormatMsgpack, "application/x-msgpack"},
+	{FormatMsgpack, "application/vnd.msgpack"},
+}
+
+// ContentType 返回格式对应的 Content-Type
+func ContentType(format string) string {
+	switch format {
+	case FormatText:
+		return "text/plain; charset=utf-8"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatMsgpack:
+		return "application/msgpack"
+	default:
+		return "application/json"
+	}
+}
+
+// NegotiateFormat 根据 ?format= 或 Accept 请求头选择响应格式。
+// ?format= 优先且必须是支持的格式；Accept 中没有支持的类型时使用JSON
+func NegotiateFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format {
+		case FormatJSON, FormatText, FormatCSV, FormatMsgpack:
+			return format, nil
+		}
+		return "", fmt.Errorf("unsupported format: %q", format)
+	}
+
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var types []accepted
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			types = append(types, accepted{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool { return types[i].q > types[j].q })
+
+	for _, t := range types {
+		if t.mediaType == "*/*" || t.mediaType == "application/*" {
+			return FormatJSON, nil
+		}
+		for _, ft := range formatTypes {
+			if t.mediaType == ft.mediaType {
+				return ft.format, nil
+			}
+		}
+		if t.mediaType == "text/*" {
+			return FormatText, nil
+		}
+	}
+	return FormatJSON, nil
+}
+
+// SendMsgpack 以 MessagePack 返回与JSON相同结构的响应
+func SendMsgpack(w http.ResponseWriter, statusCode int, message string, data interface{}) {
+	w.Header().Set("Content-Type", ContentType(FormatMsgpack))
+	w.WriteHeader(statusCode)
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(models.Response{Message: message, Data: data}); err != nil {
+		return
+	}
+}
+
+// SendFormattedError 按协商的格式返回错误，纯文本和CSV只返回错误信息
+func SendFormattedError(w http.ResponseWriter, format string, statusCode int, err error, message string) {
+	switch format {
+	case FormatText, FormatCSV:
+		w.Header().Set("Content-Type", ContentType(FormatText))
+		w.WriteHeader(statusCode)
+		if _, err := fmt.Fprintln(w, message); err != nil {
+			return
+		}
+	case FormatMsgpack:
+		resp := models.ErrorResponse{Message: message}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		w.Header().Set("Content-Type", ContentType(FormatMsgpack))
+		w.WriteHeader(statusCode)
+		enc := msgpack.NewEncoder(w)
+		enc.SetCustomStructTag("json")
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	default:
+		SendError(w, statusCode, err, message)
+	}
+}
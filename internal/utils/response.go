@@ -6,7 +6,9 @@ import (
 	"net/http"
 )
 
+// SendResponse 以JSON返回响应，Content-Type 由各响应函数自行设置
 func SendResponse(w http.ResponseWriter, statusCode int, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	err := json.NewEncoder(w).Encode(models.Response{
 		Message: message,
@@ -18,6 +20,7 @@ func SendResponse(w http.ResponseWriter, statusCode int, message string, data in
 }
 
 func SendError(w http.ResponseWriter, statusCode int, err error, message string) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	resp := models.ErrorResponse{
 		Message: message,
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// staticMaxAge 静态资源的缓存时间。地址不带版本号，
+// 过期后浏览器通过 ETag 重新验证，未修改时只返回304
+const staticMaxAge = "public, max-age=3600"
+
+type staticFile struct {
+	content []byte
+	etag    string
+}
+
+// StaticHandler 提供 fsys 中的静态文件，请求路径需已去掉前缀。
+// 内嵌资源在启动时计算 ETag；开发模式下每次从磁盘读取并禁止缓存
+func StaticHandler(fsys fs.FS, dev bool) (http.Handler, error) {
+	if dev {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-cache")
+			http.FileServer(http.FS(fsys)).ServeHTTP(w, r)
+		}), nil
+	}
+
+	files := make(map[string]staticFile)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		files[name] = staticFile{content: content, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		file, ok := files[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", staticMaxAge)
+		w.Header().Set("ETag", file.etag)
+		// ServeContent 根据 ETag 处理 If-None-Match 并设置 Content-Type
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(file.content))
+	}), nil
+}
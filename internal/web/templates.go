@@ -0,0 +1,61 @@
+package web
+
+import (
+	"html/template"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// Templates 缓存解析后的模板。以第一个文件为页面模板、其余为共享定义，
+// 每组文件只解析一次；开发模式下每次请求都从磁盘重新解析，修改模板无需重启
+type Templates struct {
+	fsys fs.FS
+	dev  bool
+
+	mu    sync.RWMutex
+	cache map[string]*template.Template
+}
+
+func NewTemplates(fsys fs.FS, dev bool) *Templates {
+	return &Templates{
+		fsys:  fsys,
+		dev:   dev,
+		cache: make(map[string]*template.Template),
+	}
+}
+
+// Get 返回由 files 组成的模板
+func (t *Templates) Get(files ...string) (*template.Template, error) {
+	if t.dev {
+		return template.ParseFS(t.fsys, files...)
+	}
+
+	key := strings.Join(files, ",")
+	t.mu.RLock()
+	tmpl, ok := t.cache[key]
+	t.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.ParseFS(t.fsys, files...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.cache[key] = tmpl
+	t.mu.Unlock()
+	return tmpl, nil
+}
+
+// Preload 在启动时解析所有模板，模板有错误时尽早失败
+func (t *Templates) Preload(sets ...[]string) error {
+	for _, files := range sets {
+		if _, err := t.Get(files...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
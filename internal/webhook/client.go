@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"heart-rate-server/internal/models"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// errPrivateAddress 目标解析到回环、内网等非公网地址
+var errPrivateAddress = errors.New("webhook target is not a public address")
+
+// Client 发送签名的Webhook请求。不跟随重定向，3xx 视为失败；
+// 默认拒绝连接非公网地址，避免被用来访问服务端所在的内网
+type Client struct {
+	http *http.Client
+}
+
+func NewClient(timeout time.Duration, allowPrivate bool) *Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// 在解析之后、连接之前检查，DNS返回的任何地址都会被检查
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip, err := netip.ParseAddr(host); err != nil || !publicIP(ip) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, host)
+			}
+			return nil
+		}
+	}
+
+	return &Client{http: &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// deniedPrefixes 不是全球可路由的地址段（IANA 特殊用途地址注册表），
+// 包括云服务商元数据服务所在的 CGNAT 段和可映射到内网 IPv4 的 NAT64/6to4 段
+var deniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// publicIP IPv4 映射的 IPv6 地址按 IPv4 检查
+func publicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Deliver 按Webhook的格式发送一次请求并返回投递记录，2xx 为成功，其余情况 Status 留空由调用方决定。
+// 聊天平台格式同样带签名头，平台会忽略
+func (c *Client) Deliver(ctx context.Context, webhook models.Webhook, t task) models.WebhookDelivery {
+	delivery := models.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventID:   t.EventID,
+		Event:     t.Event,
+		Attempt:   t.Attempt,
+	}
+
+	body, contentType, err := render(webhook, t)
+	if err != nil {
+		delivery.Error = truncate(err.Error())
+		return delivery
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = truncate(err.Error())
+		return delivery
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "heart-rate-server-webhook")
+	req.Header.Set("X-Webhook-ID", t.EventID)
+	req.Header.Set("X-Webhook-Event", t.Event)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(webhook.Secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = truncate(err.Error())
+		return delivery
+	}
+	defer resp.Body.Close()
+	// 读完响应以便复用连接，内容不使用
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		delivery.Status = models.WebhookDeliveryDelivered
+	} else {
+		delivery.Error = resp.Status
+	}
+	return delivery
+}
+
+// truncate 错误信息按投递记录的列宽截断
+func truncate(message string) string {
+	if len(message) > 255 {
+		return message[:255]
+	}
+	return message
+}
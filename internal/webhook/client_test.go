@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"heart-rate-server/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func pingTask(attempt int) task {
+	return task{EventID: "evt-1", WebhookID: 1, UserID: 1, Event: models.WebhookEventPing, CreatedAt: 1700000000000, Attempt: attempt}
+}
+
+func testWebhook(url, secret string) models.Webhook {
+	webhook := models.Webhook{URL: url, Secret: secret, Format: models.WebhookFormatGeneric, Enabled: true}
+	webhook.ID = 1
+	return webhook
+}
+
+func TestDeliverSignsBody(t *testing.T) {
+	const secret = "test-secret"
+	var verified atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Webhook-Signature") != "sha256="+Sign(secret, timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload models.WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil || payload.ID != "evt-1" || payload.Event != models.WebhookEventPing {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		verified.Store(true)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClient(5*time.Second, true)
+	webhook := testWebhook(server.URL, secret)
+	delivery := client.Deliver(context.Background(), webhook, pingTask(1))
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.StatusCode != http.StatusNoContent {
+		t.Fatalf("got status %q code %d error %q, want delivered 204", delivery.Status, delivery.StatusCode, delivery.Error)
+	}
+	if !verified.Load() {
+		t.Fatal("receiver did not verify the signature")
+	}
+}
+
+// TestDeliverFailureOutcomes 只覆盖 Deliver 的失败结果和 outcome 的判定，
+// 重试与死信队列的写入由 Dispatcher.process 完成，不在此测试
+func TestDeliverFailureOutcomes(t *testing.T) {
+	const maxAttempts = 3
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient(5*time.Second, true)
+	webhook := testWebhook(server.URL, "s")
+	want := []string{models.WebhookDeliveryRetrying, models.WebhookDeliveryRetrying, models.WebhookDeliveryDead}
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delivery := client.Deliver(context.Background(), webhook, pingTask(attempt))
+		// 非 2xx 时 Status 留空，由调度器决定重试还是进入死信
+		if delivery.Status != "" || delivery.StatusCode != http.StatusInternalServerError || delivery.Error == "" {
+			t.Fatalf("attempt %d: got status %q code %d error %q", attempt, delivery.Status, delivery.StatusCode, delivery.Error)
+		}
+		if got := outcome(delivery, maxAttempts); got != want[attempt-1] {
+			t.Fatalf("attempt %d: got outcome %q, want %q", attempt, got, want[attempt-1])
+		}
+	}
+}
+
+func TestDeliverRecoversOnRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(5*time.Second, true)
+	webhook := testWebhook(server.URL, "s")
+	first := client.Deliver(context.Background(), webhook, pingTask(1))
+	if got := outcome(first, 5); got != models.WebhookDeliveryRetrying {
+		t.Fatalf("first attempt: got outcome %q, want retrying", got)
+	}
+	second := client.Deliver(context.Background(), webhook, pingTask(2))
+	if got := outcome(second, 5); got != models.WebhookDeliveryDelivered {
+		t.Fatalf("second attempt: got outcome %q, want delivered", got)
+	}
+}
+
+func TestDeliverDoesNotFollowRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := NewClient(5*time.Second, true)
+	webhook := testWebhook(server.URL, "s")
+	delivery := client.Deliver(context.Background(), webhook, pingTask(1))
+	if delivery.Status != "" || delivery.StatusCode != http.StatusFound {
+		t.Fatalf("got status %q code %d, want undelivered 302", delivery.Status, delivery.StatusCode)
+	}
+}
+
+func TestDeliverRejectsPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(5*time.Second, false)
+	webhook := testWebhook(server.URL, "s")
+	delivery := client.Deliver(context.Background(), webhook, pingTask(1))
+	if delivery.Status != "" || !strings.Contains(delivery.Error, errPrivateAddress.Error()) {
+		t.Fatalf("got status %q error %q, want private address error", delivery.Status, delivery.Error)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"8.8.8.8":                true,
+		"1.1.1.1":                true,
+		"2606:4700:4700::1111":   true,
+		"100.63.255.255":         true,
+		"0.0.0.0":                false,
+		"10.1.2.3":               false,
+		"100.100.100.200":        false,
+		"127.0.0.1":              false,
+		"169.254.169.254":        false,
+		"172.16.0.1":             false,
+		"192.0.0.8":              false,
+		"192.168.1.1":            false,
+		"198.18.0.1":             false,
+		"203.0.113.5":            false,
+		"224.0.0.1":              false,
+		"255.255.255.255":        false,
+		"::":                     false,
+		"::1":                    false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:100.100.100.200": false,
+		"64:ff9b::a9fe:a9fe":     false,
+		"2002:a9fe:a9fe::1":      false,
+		"fd00::1":                false,
+		"fe80::1":                false,
+		"ff02::1":                false,
+	}
+	for addr, want := range cases {
+		if got := publicIP(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+// Package webhook 把用户订阅的事件投递到其登记的地址。事件先写入Redis Stream，
+// 由各实例的后台 worker 通过消费组读取并投递，失败后按指数退避重试，超过次数进入死信队列
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"heart-rate-server/internal/models"
+	"heart-rate-server/internal/storage"
+	"heart-rate-server/internal/utils"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// 队列使用的键共享同一个 hash tag，Cluster 模式下可以在一个脚本中操作
+const (
+	streamKey = "webhook:{queue}"
+	retryKey  = "webhook:{queue}:retry"
+	deadKey   = "webhook:{queue}:dead"
+
+	consumerGroup = "webhook_workers"
+)
+
+const (
+	// maxStreamLen、maxDeadLen 队列和死信队列的近似长度上限
+	maxStreamLen = 100000
+	maxDeadLen   = 10000
+
+	// 重试间隔从 retryBaseDelay 开始每次翻倍，不超过 retryMaxDelay
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = time.Hour
+
+	// promoteInterval 把到期的重试放回队列的间隔
+	promoteInterval = time.Second
+	// claimIdle 其它 worker 读取后超过该时间仍未确认的消息（实例退出等）被重新领取
+	claimIdle = 2 * time.Minute
+	// deliveryRetention 投递记录的保留时长
+	deliveryRetention = 7 * 24 * time.Hour
+
+	// webhookCacheTTL 用户的Webhook在本实例缓存的时间，其它实例上的修改最多在此时间后生效
+	webhookCacheTTL = 5 * time.Second
+)
+
+// promoteScript 把到期的重试原子地移回队列，多个实例同时执行时每条只移动一次
+var promoteScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, entry in ipairs(due) do
+	redis.call('ZREM', KEYS[1], entry)
+	redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], '*', 'entry', entry)
+end
+return #due
+`)
+
+// touchScript 刷新最后上报时间并返回键此前是否存在。键的过期时间为间隔阈值，
+// 不存在说明是第一条样本或距上一条已超过阈值
+var touchScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return existed
+`)
+
+// task 队列中的一次投递，重试时只增加 Attempt
+type task struct {
+	EventID   string          `json:"event_id"`
+	WebhookID uint            `json:"webhook_id"`
+	UserID    uint            `json:"user_id"`
+	Event     string          `json:"event"`
+	CreatedAt int64           `json:"created_at"`
+	Attempt   int             `json:"attempt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type webhookEntry struct {
+	webhooks  []models.Webhook
+	expiresAt time.Time
+}
+
+// Dispatcher 发布事件并在后台投递
+type Dispatcher struct {
+	DB          *gorm.DB
+	Redis       redis.UniversalClient
+	Client      *Client
+	Workers     int
+	MaxAttempts int
+	// Gap 样本间隔超过 Gap 后的第一条样本发布 stream.started
+	Gap time.Duration
+
+	consumer string
+
+	mu       sync.Mutex
+	capacity int
+	webhooks map[uint]webhookEntry
+}
+
+func NewDispatcher(db *gorm.DB, redis redis.UniversalClient, client *Client, workers, maxAttempts int, gap time.Duration, cacheSize int) *Dispatcher {
+	if cacheSize <= 0 {
+		cacheSize = 1
+	}
+	hostname, _ := os.Hostname()
+	return &Dispatcher{
+		DB:          db,
+		Redis:       redis,
+		Client:      client,
+		Workers:     workers,
+		MaxAttempts: maxAttempts,
+		Gap:         gap,
+		consumer:    fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		capacity:    cacheSize,
+		webhooks:    make(map[uint]webhookEntry),
+	}
+}
+
+// Sign 计算签名：以 secret 为密钥对 "时间戳.请求体" 做HMAC-SHA256，十六进制编码
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newEventID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Invalidate 清除用户Webhook在本实例的缓存，修改后调用
+func (d *Dispatcher) Invalidate(userID uint) {
+	d.mu.Lock()
+	delete(d.webhooks, userID)
+	d.mu.Unlock()
+}
+
+// DeleteUser 清除已删除用户的Webhook缓存和最后样本时间
+func (d *Dispatcher) DeleteUser(ctx context.Context, userID uint) error {
+	d.Invalidate(userID)
+	return d.Redis.Del(ctx, lastSampleKey(userID)).Err()
+}
+
+// userWebhooks 返回用户的全部Webhook（包括已停用的），没有Webhook的用户同样缓存
+func (d *Dispatcher) userWebhooks(ctx context.Context, userID uint) ([]models.Webhook, error) {
+	d.mu.Lock()
+	entry, ok := d.webhooks[userID]
+	d.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.webhooks, nil
+	}
+
+	var webhooks []models.Webhook
+	if err := d.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.webhooks) >= d.capacity {
+		d.webhooks = make(map[uint]webhookEntry)
+	}
+	d.webhooks[userID] = webhookEntry{webhooks: webhooks, expiresAt: time.Now().Add(webhookCacheTTL)}
+	return webhooks, nil
+}
+
+func lastSampleKey(userID uint) string {
+	return storage.UserKey("webhook_last_sample", userID)
+}
+
+// subscribers 返回启用且订阅了事件的Webhook
+func subscribers(webhooks []models.Webhook, event string) []uint {
+	var targets []uint
+	for _, webhook := range webhooks {
+		if webhook.Enabled && slices.Contains(webhook.Events, event) {
+			targets = append(targets, webhook.ID)
+		}
+	}
+	return targets
+}
+
+// Publish 把事件加入订阅了它的每个Webhook的投递队列，错误只记录日志，不影响调用方
+func (d *Dispatcher) Publish(ctx context.Context, userID uint, event string, data interface{}) {
+	webhooks, err := d.userWebhooks(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load webhooks for user %d: %v", userID, err)
+		return
+	}
+	d.publish(ctx, userID, subscribers(webhooks, event), event, data)
+}
+
+// PublishSample 发布 sample.received，间隔超过 Gap 后的第一条样本同时发布 stream.started。
+// 只有订阅了 stream.started 的用户才记录最后上报时间
+func (d *Dispatcher) PublishSample(ctx context.Context, userID uint, data models.HeartRateData) {
+	webhooks, err := d.userWebhooks(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load webhooks for user %d: %v", userID, err)
+		return
+	}
+	d.publish(ctx, userID, subscribers(webhooks, models.WebhookEventSample), models.WebhookEventSample, data)
+
+	targets := subscribers(webhooks, models.WebhookEventStreamStarted)
+	if len(targets) == 0 {
+		return
+	}
+	existed, err := touchScript.Run(ctx, d.Redis, []string{lastSampleKey(userID)}, data.MeasuredAt, d.Gap.Milliseconds()).Int()
+	if err != nil {
+		log.Printf("Failed to update last sample time for user %d: %v", userID, err)
+		return
+	}
+	if existed == 0 {
+		d.publish(ctx, userID, targets, models.WebhookEventStreamStarted, data)
+	}
+}
+
+func (d *Dispatcher) publish(ctx context.Context, userID uint, targets []uint, event string, data interface{}) {
+	if len(targets) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode webhook event %s: %v", event, err)
+		return
+	}
+	t := task{EventID: newEventID(), UserID: userID, Event: event, CreatedAt: utils.CurrentMillis(), Attempt: 1, Data: payload}
+	for _, id := range targets {
+		t.WebhookID = id
+		if err := d.enqueue(ctx, t); err != nil {
+			log.Printf("Failed to enqueue webhook %d: %v", id, err)
+		}
+	}
+}
+
+// PublishAlert 发布告警规则的触发与恢复，未上报规则使用 data.* 事件
+func (d *Dispatcher) PublishAlert(ctx context.Context, event models.AlertEvent) {
+	name := models.WebhookEventAlertFired
+	switch {
+	case event.Type == models.AlertTypeNoData && event.State == models.AlertStateFiring:
+		name = models.WebhookEventDataStopped
+	case event.Type == models.AlertTypeNoData:
+		name = models.WebhookEventDataResumed
+	case event.State == models.AlertStateResolved:
+		name = models.WebhookEventAlertResolved
+	}
+
+	// 与告警记录接口返回的结构相同
+	d.Publish(ctx, event.UserID, name, models.AlertEventResponse{
+		ID:        event.ID,
+		RuleID:    event.RuleID,
+		RuleName:  event.RuleName,
+		Type:      event.Type,
+		State:     event.State,
+		Value:     event.Value,
+		Threshold: event.Threshold,
+		CreatedAt: utils.TimeToMillis(event.CreatedAt),
+	})
+}
+
+// Ping 向指定Webhook发送测试事件，返回事件ID
+func (d *Dispatcher) Ping(ctx context.Context, webhook models.Webhook) (string, error) {
+	data, err := json.Marshal(map[string]uint{"webhook_id": webhook.ID})
+	if err != nil {
+		return "", err
+	}
+	t := task{
+		EventID:   newEventID(),
+		WebhookID: webhook.ID,
+		UserID:    webhook.UserID,
+		Event:     models.WebhookEventPing,
+		CreatedAt: utils.CurrentMillis(),
+		Attempt:   1,
+		Data:      data,
+	}
+	return t.EventID, d.enqueue(ctx, t)
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, t task) error {
+	entry, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return d.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		MaxLen: maxStreamLen,
+		Approx: true,
+		Values: map[string]interface{}{"entry": string(entry)},
+	}).Err()
+}
+
+// retryDelay 第 attempt 次失败后的等待时间
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
+
+// outcome 投递失败时，未达到最大次数的进入重试，否则进入死信
+func outcome(delivery models.WebhookDelivery, maxAttempts int) string {
+	switch {
+	case delivery.Status == models.WebhookDeliveryDelivered:
+		return models.WebhookDeliveryDelivered
+	case delivery.Attempt >= maxAttempts:
+		return models.WebhookDeliveryDead
+	default:
+		return models.WebhookDeliveryRetrying
+	}
+}
+
+func (d *Dispatcher) ensureGroup(ctx context.Context) error {
+	err := d.Redis.XGroupCreateMkStream(ctx, streamKey, consumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// Run 读取队列并投递，阻塞直到 ctx 结束。未确认的消息留在消费组中，由其它实例或重启后重新领取
+func (d *Dispatcher) Run(ctx context.Context) {
+	jobs := make(chan redis.XMessage)
+	var wg sync.WaitGroup
+	for i := 0; i < d.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range jobs {
+				d.process(ctx, msg)
+			}
+		}()
+	}
+	maintained := make(chan struct{})
+	go func() {
+		defer close(maintained)
+		d.maintain(ctx, jobs)
+	}()
+	defer func() {
+		<-maintained
+		close(jobs)
+		wg.Wait()
+	}()
+
+	grouped := false
+	for ctx.Err() == nil {
+		if !grouped {
+			if err := d.ensureGroup(ctx); err != nil {
+				log.Printf("Failed to create webhook consumer group: %v", err)
+				sleep(ctx, time.Second)
+				continue
+			}
+			grouped = true
+		}
+		streams, err := d.Redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    consumerGroup,
+			Consumer: d.consumer,
+			Streams:  []string{streamKey, ">"},
+			Count:    int64(d.Workers),
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				// 队列被删除（如 FLUSHDB）后重新创建消费组
+				grouped = !strings.HasPrefix(err.Error(), "NOGROUP")
+				log.Printf("Failed to read webhook queue: %v", err)
+				sleep(ctx, time.Second)
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				select {
+				case jobs <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// maintain 把到期的重试放回队列，重新领取长时间未确认的消息，并清理过期的投递记录
+func (d *Dispatcher) maintain(ctx context.Context, jobs chan<- redis.XMessage) {
+	promote := time.NewTicker(promoteInterval)
+	defer promote.Stop()
+	claim := time.NewTicker(claimIdle / 2)
+	defer claim.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-promote.C:
+			now := fmt.Sprint(utils.CurrentMillis())
+			err := promoteScript.Run(ctx, d.Redis, []string{retryKey, streamKey}, now, 100, maxStreamLen).Err()
+			if err != nil && !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Printf("Failed to promote webhook retries: %v", err)
+			}
+		case <-claim.C:
+			msgs, _, err := d.Redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   streamKey,
+				Group:    consumerGroup,
+				Consumer: d.consumer,
+				MinIdle:  claimIdle,
+				Start:    "0",
+				Count:    100,
+			}).Result()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Failed to claim stale webhook deliveries: %v", err)
+				}
+				continue
+			}
+			for _, msg := range msgs {
+				select {
+				case jobs <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		case <-prune.C:
+			cutoff := time.Now().Add(-deliveryRetention)
+			if err := d.DB.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&models.WebhookDelivery{}).Error; err != nil {
+				log.Printf("Failed to prune webhook deliveries: %v", err)
+			}
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// process 投递一条消息并记录结果，失败时安排重试或放入死信队列，最后确认消息
+func (d *Dispatcher) process(ctx context.Context, msg redis.XMessage) {
+	entry, _ := msg.Values["entry"].(string)
+	var t task
+	if err := json.Unmarshal([]byte(entry), &t); err != nil {
+		log.Printf("Dropping malformed webhook task %s: %v", msg.ID, err)
+		d.ack(ctx, msg.ID)
+		return
+	}
+
+	webhooks, err := d.userWebhooks(ctx, t.UserID)
+	if err != nil {
+		// 留在消费组中，稍后重新领取
+		log.Printf("Failed to load webhooks for user %d: %v", t.UserID, err)
+		return
+	}
+	i := slices.IndexFunc(webhooks, func(w models.Webhook) bool { return w.ID == t.WebhookID })
+	if i < 0 || (!webhooks[i].Enabled && t.Event != models.WebhookEventPing) {
+		d.ack(ctx, msg.ID)
+		return
+	}
+
+	delivery := d.Client.Deliver(ctx, webhooks[i], t)
+	if ctx.Err() != nil {
+		return
+	}
+	delivery.Status = outcome(delivery, d.MaxAttempts)
+	switch delivery.Status {
+	case models.WebhookDeliveryDelivered:
+	case models.WebhookDeliveryDead:
+		err = d.Redis.XAdd(ctx, &redis.XAddArgs{
+			Stream: deadKey,
+			MaxLen: maxDeadLen,
+			Approx: true,
+			Values: map[string]interface{}{"entry": entry, "error": delivery.Error},
+		}).Err()
+	default:
+		next := t
+		next.Attempt++
+		var encoded []byte
+		if encoded, err = json.Marshal(next); err == nil {
+			due := time.Now().Add(retryDelay(t.Attempt)).UnixMilli()
+			err = d.Redis.ZAdd(ctx, retryKey, &redis.Z{Score: float64(due), Member: string(encoded)}).Err()
+		}
+	}
+	if err != nil {
+		// 重试或死信写入失败时不确认，消息稍后被重新领取
+		log.Printf("Failed to reschedule webhook %d delivery %s: %v", t.WebhookID, t.EventID, err)
+		return
+	}
+
+	if err := d.DB.WithContext(ctx).Create(&delivery).Error; err != nil {
+		log.Printf("Failed to record webhook delivery: %v", err)
+	}
+	d.ack(ctx, msg.ID)
+}
+
+func (d *Dispatcher) ack(ctx context.Context, id string) {
+	pipe := d.Redis.TxPipeline()
+	pipe.XAck(ctx, streamKey, consumerGroup, id)
+	pipe.XDel(ctx, streamKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to acknowledge webhook task %s: %v", id, err)
+	}
+}
@@ -0,0 +1,18 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second}
+	for i, delay := range want {
+		if got := retryDelay(i + 1); got != delay {
+			t.Errorf("retryDelay(%d) = %v, want %v", i+1, got, delay)
+		}
+	}
+	if got := retryDelay(20); got != retryMaxDelay {
+		t.Errorf("retryDelay(20) = %v, want %v", got, retryMaxDelay)
+	}
+}
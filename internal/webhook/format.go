@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"heart-rate-server/internal/models"
+	"net/url"
+	"regexp"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+const (
+	// maxBodySize 模板生成的请求体上限
+	maxBodySize = 64 << 10
+	// discordContentLimit Discord 消息 content 的字符上限
+	discordContentLimit = 2000
+)
+
+var (
+	errBodyTooLarge = errors.New("template output exceeds 64KB")
+	// unsafeVerb printf 中的 * 宽度和超过三位数的宽度/精度会分配大量内存
+	unsafeVerb = regexp.MustCompile(`%[^a-zA-Z%]*(\*|\d{4,})`)
+)
+
+// Message 模板的数据。Text 为内置格式使用的文字消息，Data 为事件数据解码后的对象
+type Message struct {
+	ID        string
+	Event     string
+	CreatedAt int64
+	Text      string
+	Data      map[string]interface{}
+}
+
+// templateFuncs 模板可用的函数。printf 替换为检查宽度的版本
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+	"printf": func(format string, args ...interface{}) (string, error) {
+		if unsafeVerb.MatchString(format) {
+			return "", fmt.Errorf("printf width or precision is too large")
+		}
+		return fmt.Sprintf(format, args...), nil
+	},
+}
+
+// limitedBuffer 超过上限后写入失败，模板执行随之停止
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxBodySize {
+		return 0, errBodyTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// parseTemplate 解析用户模板。不允许 range、define 和 template，执行时间只与模板长度有关
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("webhook").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, fmt.Errorf("define and block are not allowed")
+	}
+	if err := checkNodes(tmpl.Tree.Root); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func checkNodes(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkNodes(child); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		if err := checkNodes(n.List); err != nil {
+			return err
+		}
+		return checkNodes(n.ElseList)
+	case *parse.WithNode:
+		if err := checkNodes(n.List); err != nil {
+			return err
+		}
+		return checkNodes(n.ElseList)
+	case *parse.RangeNode:
+		return fmt.Errorf("range is not allowed")
+	case *parse.TemplateNode:
+		return fmt.Errorf("template is not allowed")
+	}
+	return nil
+}
+
+// ValidateFormat 检查格式相关的设置：Telegram 地址需要 chat_id 参数，模板必须能解析并执行
+func ValidateFormat(format, rawURL, text string) error {
+	switch format {
+	case models.WebhookFormatTelegram:
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return err
+		}
+		if u.Query().Get("chat_id") == "" {
+			return fmt.Errorf("telegram url must include chat_id, e.g. https://api.telegram.org/bot<token>/sendMessage?chat_id=<chat>")
+		}
+	case models.WebhookFormatTemplate:
+		if text == "" {
+			return fmt.Errorf("template is required")
+		}
+		tmpl, err := parseTemplate(text)
+		if err != nil {
+			return err
+		}
+		sample := Message{ID: "0", Event: models.WebhookEventPing, Text: describe(models.WebhookEventPing, nil), Data: map[string]interface{}{}}
+		if err := tmpl.Execute(&limitedBuffer{}, sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// render 按Webhook的格式生成请求体和 Content-Type
+func render(webhook models.Webhook, t task) ([]byte, string, error) {
+	const contentType = "application/json"
+
+	text := describe(t.Event, t.Data)
+	var body interface{}
+	switch webhook.Format {
+	case models.WebhookFormatDiscord:
+		if utf8.RuneCountInString(text) > discordContentLimit {
+			text = string([]rune(text)[:discordContentLimit])
+		}
+		body = map[string]string{"content": text}
+	case models.WebhookFormatSlack:
+		body = map[string]string{"text": text}
+	case models.WebhookFormatTelegram:
+		u, err := url.Parse(webhook.URL)
+		if err != nil {
+			return nil, "", err
+		}
+		body = map[string]string{"chat_id": u.Query().Get("chat_id"), "text": text}
+	case models.WebhookFormatFeishu:
+		body = map[string]interface{}{"msg_type": "text", "content": map[string]string{"text": text}}
+	case models.WebhookFormatTemplate:
+		return renderTemplate(webhook.Template, t, text)
+	default:
+		body = models.WebhookPayload{ID: t.EventID, Event: t.Event, CreatedAt: t.CreatedAt, Data: t.Data}
+	}
+
+	encoded, err := json.Marshal(body)
+	return encoded, contentType, err
+}
+
+// renderTemplate 执行用户模板，输出是合法JSON时以 application/json 发送，否则为纯文本
+func renderTemplate(text string, t task, message string) ([]byte, string, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return nil, "", err
+	}
+	data := map[string]interface{}{}
+	if len(t.Data) > 0 {
+		if err := json.Unmarshal(t.Data, &data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var buf limitedBuffer
+	err = tmpl.Execute(&buf, Message{ID: t.EventID, Event: t.Event, CreatedAt: t.CreatedAt, Text: message, Data: data})
+	if err != nil {
+		return nil, "", err
+	}
+	if json.Valid(buf.Bytes()) {
+		return buf.Bytes(), "application/json", nil
+	}
+	return buf.Bytes(), "text/plain; charset=utf-8", nil
+}
+
+// describe 生成事件的文字消息，供聊天平台格式和模板的 .Text 使用
+func describe(event string, data json.RawMessage) string {
+	switch event {
+	case models.WebhookEventSample, models.WebhookEventStreamStarted:
+		var sample models.HeartRateData
+		if err := json.Unmarshal(data, &sample); err != nil {
+			break
+		}
+		if event == models.WebhookEventStreamStarted {
+			return fmt.Sprintf("💓 开始上报心率：%d bpm", sample.Data.HeartRate)
+		}
+		return fmt.Sprintf("💓 心率 %d bpm", sample.Data.HeartRate)
+	case models.WebhookEventAlertFired, models.WebhookEventAlertResolved,
+		models.WebhookEventDataStopped, models.WebhookEventDataResumed:
+		var alert models.AlertEventResponse
+		if err := json.Unmarshal(data, &alert); err != nil {
+			break
+		}
+		switch event {
+		case models.WebhookEventAlertFired:
+			return fmt.Sprintf("🚨 告警「%s」触发：%g（阈值 %d）", alert.RuleName, alert.Value, alert.Threshold)
+		case models.WebhookEventAlertResolved:
+			return fmt.Sprintf("✅ 告警「%s」已恢复：%g", alert.RuleName, alert.Value)
+		case models.WebhookEventDataStopped:
+			return fmt.Sprintf("⚠️ 告警「%s」：已 %g 秒没有上报心率", alert.RuleName, alert.Value)
+		default:
+			return fmt.Sprintf("✅ 告警「%s」：已恢复上报", alert.RuleName)
+		}
+	case models.WebhookEventPing:
+		return "🔔 Webhook 测试消息"
+	}
+	return event
+}
@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"heart-rate-server/internal/models"
+	"strings"
+	"testing"
+)
+
+func sampleData(heartRate int) json.RawMessage {
+	var sample models.HeartRateData
+	sample.Data.HeartRate = heartRate
+	encoded, _ := json.Marshal(sample)
+	return encoded
+}
+
+func alertData(name string, value float64, threshold int) json.RawMessage {
+	encoded, _ := json.Marshal(models.AlertEventResponse{RuleName: name, Value: value, Threshold: threshold})
+	return encoded
+}
+
+func TestDescribe(t *testing.T) {
+	cases := []struct {
+		event string
+		data  json.RawMessage
+		want  string
+	}{
+		{models.WebhookEventSample, sampleData(72), "💓 心率 72 bpm"},
+		{models.WebhookEventStreamStarted, sampleData(80), "💓 开始上报心率：80 bpm"},
+		{models.WebhookEventAlertFired, alertData("过高", 131, 120), "🚨 告警「过高」触发：131（阈值 120）"},
+		{models.WebhookEventAlertResolved, alertData("过高", 98.5, 120), "✅ 告警「过高」已恢复：98.5"},
+		{models.WebhookEventDataStopped, alertData("断线", 300, 300), "⚠️ 告警「断线」：已 300 秒没有上报心率"},
+		{models.WebhookEventDataResumed, alertData("断线", 0, 300), "✅ 告警「断线」：已恢复上报"},
+		{models.WebhookEventPing, nil, "🔔 Webhook 测试消息"},
+		// 数据无法解析或事件未知时退回事件名
+		{models.WebhookEventSample, json.RawMessage(`"bad"`), models.WebhookEventSample},
+		{"unknown.event", nil, "unknown.event"},
+	}
+	for _, tc := range cases {
+		if got := describe(tc.event, tc.data); got != tc.want {
+			t.Errorf("describe(%s, %s) = %q, want %q", tc.event, tc.data, got, tc.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	sample := task{EventID: "evt-1", Event: models.WebhookEventSample, CreatedAt: 1700000000000, Data: sampleData(72)}
+	cases := []struct {
+		name   string
+		format string
+		url    string
+		want   string
+	}{
+		{"discord", models.WebhookFormatDiscord, "https://discord.example/api/webhooks/1", `{"content":"💓 心率 72 bpm"}`},
+		{"slack", models.WebhookFormatSlack, "https://hooks.slack.example/x", `{"text":"💓 心率 72 bpm"}`},
+		{"telegram", models.WebhookFormatTelegram, "https://api.telegram.org/botX/sendMessage?chat_id=-100", `{"chat_id":"-100","text":"💓 心率 72 bpm"}`},
+		{"feishu", models.WebhookFormatFeishu, "https://open.feishu.example/hook/x", `{"content":{"text":"💓 心率 72 bpm"},"msg_type":"text"}`},
+	}
+	for _, tc := range cases {
+		webhook := testWebhook(tc.url, "s")
+		webhook.Format = tc.format
+		body, contentType, err := render(webhook, sample)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(body) != tc.want || contentType != "application/json" {
+			t.Errorf("%s: got %s (%s), want %s", tc.name, body, contentType, tc.want)
+		}
+	}
+
+	body, _, err := render(testWebhook("https://example.com", "s"), sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload models.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.ID != "evt-1" || payload.Event != models.WebhookEventSample || payload.CreatedAt != sample.CreatedAt {
+		t.Errorf("generic: got %s, want the webhook payload", body)
+	}
+}
+
+func TestRenderDiscordTruncates(t *testing.T) {
+	webhook := testWebhook("https://discord.example/api/webhooks/1", "s")
+	webhook.Format = models.WebhookFormatDiscord
+	name := strings.Repeat("心", 3000)
+	body, _, err := render(webhook, task{Event: models.WebhookEventAlertFired, Data: alertData(name, 130, 120)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		t.Fatal(err)
+	}
+	if got := len([]rune(message.Content)); got != discordContentLimit {
+		t.Errorf("got %d runes, want %d", got, discordContentLimit)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	alert := task{EventID: "evt-2", Event: models.WebhookEventAlertFired, Data: alertData("过高", 131, 120)}
+	cases := []struct {
+		name            string
+		template        string
+		want            string
+		wantContentType string
+	}{
+		{"json output", `{"msg":{{json .Text}},"value":{{.Data.value}}}`, `{"msg":"🚨 告警「过高」触发：131（阈值 120）","value":131}`, "application/json"},
+		{"text output", `{{.Event}} {{.ID}}`, `alert.fired evt-2`, "text/plain; charset=utf-8"},
+		{"if and with", `{{if .Data.rule_name}}{{with .Data}}{{.rule_name}}{{end}}{{end}}`, `过高`, "text/plain; charset=utf-8"},
+		{"printf", `{{printf "%.1f bpm" .Data.value}}`, `131.0 bpm`, "text/plain; charset=utf-8"},
+	}
+	for _, tc := range cases {
+		webhook := testWebhook("https://example.com", "s")
+		webhook.Format = models.WebhookFormatTemplate
+		webhook.Template = tc.template
+		body, contentType, err := render(webhook, alert)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(body) != tc.want || contentType != tc.wantContentType {
+			t.Errorf("%s: got %s (%s), want %s (%s)", tc.name, body, contentType, tc.want, tc.wantContentType)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		wantErr  string
+	}{
+		{"plain", `{{.Text}}`, ""},
+		{"if else", `{{if .Data}}a{{else}}b{{end}}`, ""},
+		{"range", `{{range .Data}}{{.}}{{end}}`, "range is not allowed"},
+		{"range nested in if", `{{if .Data}}{{range .Data}}x{{end}}{{end}}`, "range is not allowed"},
+		{"range nested in with else", `{{with .Data}}x{{else}}{{range .Data}}x{{end}}{{end}}`, "range is not allowed"},
+		{"define", `{{define "a"}}x{{end}}{{template "a"}}`, "define and block are not allowed"},
+		{"block", `{{block "a" .}}x{{end}}`, "define and block are not allowed"},
+		{"template", `{{template "webhook" .}}`, "template is not allowed"},
+		{"syntax error", `{{.Text`, "unclosed action"},
+	}
+	for _, tc := range cases {
+		_, err := parseTemplate(tc.template)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestTemplateOutputLimit(t *testing.T) {
+	// 每个 printf 输出 999 字节，重复足够多次超过上限
+	large := strings.Repeat(`{{printf "%999d" 1}}`, maxBodySize/999+1)
+	webhook := testWebhook("https://example.com", "s")
+	webhook.Format = models.WebhookFormatTemplate
+	webhook.Template = large
+	if _, _, err := render(webhook, pingTask(1)); !errors.Is(err, errBodyTooLarge) {
+		t.Errorf("got error %v, want %v", err, errBodyTooLarge)
+	}
+
+	webhook.Template = strings.Repeat(`{{printf "%999d" 1}}`, maxBodySize/999)
+	if body, _, err := render(webhook, pingTask(1)); err != nil || len(body) > maxBodySize {
+		t.Errorf("got %d bytes error %v, want output within the limit", len(body), err)
+	}
+}
+
+func TestPrintfWidth(t *testing.T) {
+	cases := map[string]bool{
+		`{{printf "%d" 1}}`:      true,
+		`{{printf "%999d" 1}}`:   true,
+		`{{printf "%.3f" 1.0}}`:  true,
+		`{{printf "%1000d" 1}}`:  false,
+		`{{printf "%.1000f" 1}}`: false,
+		`{{printf "%*d" 9 1}}`:   false,
+		`{{printf "%-*d" 9 1}}`:  false,
+	}
+	for text, ok := range cases {
+		tmpl, err := parseTemplate(text)
+		if err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		err = tmpl.Execute(&limitedBuffer{}, Message{})
+		if (err == nil) != ok {
+			t.Errorf("%s: got error %v, want ok %v", text, err, ok)
+		}
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		format   string
+		url      string
+		template string
+		wantErr  bool
+	}{
+		{"generic", models.WebhookFormatGeneric, "https://example.com", "", false},
+		{"telegram with chat_id", models.WebhookFormatTelegram, "https://api.telegram.org/botX/sendMessage?chat_id=1", "", false},
+		{"telegram without chat_id", models.WebhookFormatTelegram, "https://api.telegram.org/botX/sendMessage", "", true},
+		{"template", models.WebhookFormatTemplate, "https://example.com", `{{.Text}}`, false},
+		{"empty template", models.WebhookFormatTemplate, "https://example.com", "", true},
+		{"template with range", models.WebhookFormatTemplate, "https://example.com", `{{range .Data}}{{end}}`, true},
+		{"template failing on execute", models.WebhookFormatTemplate, "https://example.com", `{{printf "%*d" 9 1}}`, true},
+	}
+	for _, tc := range cases {
+		if err := ValidateFormat(tc.format, tc.url, tc.template); (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"github.com/gorilla/mux"
+	"heart-rate-server/internal/alert"
 	"heart-rate-server/internal/config"
 	"heart-rate-server/internal/handlers"
+	"heart-rate-server/internal/live"
 	"heart-rate-server/internal/middleware"
 	"heart-rate-server/internal/storage"
+	"heart-rate-server/internal/web"
+	"heart-rate-server/internal/webhook"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
@@ -42,51 +47,192 @@ func main() {
 	// Initialize secure cookie
 	secureCookie := middleware.NewSecureCookie(cfg.CookieHashKey, cfg.CookieBlockKey)
 
+	// 初始化缓存中间件，并订阅跨实例的失效广播
+	uuidCacheMiddleware := middleware.NewUUIDCacheMiddleware(db, redisClient, cfg.UUIDCacheSize)
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go uuidCacheMiddleware.Listen(bgCtx)
+	shareLinkMiddleware := middleware.NewShareLinkMiddleware(db, redisClient, cfg.UUIDCacheSize)
+	signedWidgetMiddleware := middleware.NewSignedWidgetMiddleware(db, redisClient, cfg.UUIDCacheSize)
+	go shareLinkMiddleware.Listen(bgCtx)
+	go signedWidgetMiddleware.Listen(bgCtx)
+	deviceAuthMiddleware := middleware.NewDeviceAuthMiddleware(db, redisClient, cfg.UUIDCacheSize)
+	go deviceAuthMiddleware.Listen(bgCtx)
+
+	// 心率存储，Redis不可用时缓冲样本并在恢复后回放
+	heartRateStore := storage.NewHeartRateStore(redisClient, cfg.HeartRateBufferSize, cfg.HistoryWindow)
+	go heartRateStore.Run(bgCtx)
+
+	// 样本归档，供超出Redis窗口的回放使用
+	sampleArchive := storage.NewSampleArchive(db, cfg.ArchiveRetention, cfg.HeartRateBufferSize)
+	go sampleArchive.Run(bgCtx)
+
+	// Webhook事件经Redis Stream由后台投递
+	webhookDispatcher := webhook.NewDispatcher(db, redisClient,
+		webhook.NewClient(cfg.WebhookTimeout, cfg.WebhookAllowPrivate), cfg.WebhookWorkers, cfg.WebhookMaxAttempts, cfg.OfflineAfter, cfg.UUIDCacheSize)
+	go webhookDispatcher.Run(bgCtx)
+
+	// 告警规则，上报时检查，未上报规则由定时任务检查，触发和恢复时发布Webhook事件
+	alertEngine := alert.NewEngine(db, redisClient, heartRateStore, cfg.StaleAfter, cfg.UUIDCacheSize)
+	alertEngine.OnEvent = webhookDispatcher.PublishAlert
+	go alertEngine.Run(bgCtx)
+
+	// 实时推送，跨实例通过Redis订阅分发
+	liveHub := live.NewHub(redisClient)
+	go liveHub.Run(bgCtx)
+
+	// 模板和静态资源默认使用内嵌文件，开发模式从工作目录读取以便热更新
+	var assets fs.FS = embeddedAssets
+	if cfg.DevMode {
+		assets = os.DirFS(".")
+	}
+	templates := web.NewTemplates(assets, cfg.DevMode)
+	if err := templates.Preload(handlers.TemplateSets()...); err != nil {
+		log.Fatalf("Failed to parse templates: %v", err)
+	}
+	staticFS, err := fs.Sub(assets, "static")
+	if err != nil {
+		log.Fatalf("Failed to load static assets: %v", err)
+	}
+	staticHandler, err := web.StaticHandler(staticFS, cfg.DevMode)
+	if err != nil {
+		log.Fatalf("Failed to load static assets: %v", err)
+	}
+
 	// Create app with dependencies
 	app := &handlers.App{
 		DB:           db,
 		Redis:        redisClient,
 		Config:       cfg,
 		SecureCookie: secureCookie,
+		Store:        heartRateStore,
+		Live:         liveHub,
+		UUIDCache:    uuidCacheMiddleware,
+		ShareLinks:   shareLinkMiddleware,
+		SignedLinks:  signedWidgetMiddleware,
+		Devices:      deviceAuthMiddleware,
+		Alerts:       alertEngine,
+		Webhooks:     webhookDispatcher,
+		Archive:      sampleArchive,
+		Replays:      storage.NewReplayStore(redisClient, cfg.ReplaySessionTTL),
+		Templates:    templates,
 	}
+	alertEngine.Prefer = app.PreferredSamples
 
 	// Create router
 	r := mux.NewRouter()
 
-	r.PathPrefix("/static/").Handler(
-		http.StripPrefix("/static/",
-			http.FileServer(http.Dir("./static")),
-		),
-	)
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", staticHandler))
 
 	// Global middleware
 	//r.Use(middleware.LoggingMiddleware)
 	r.Use(middleware.RecoveryMiddleware)
-	r.Use(middleware.JSONContentTypeMiddleware)
 
 	// Public routes
 	r.HandleFunc("/", app.IndexHandler).Methods("GET")
-	r.HandleFunc("/health", handlers.HealthHandler).Methods("GET")
+	r.HandleFunc("/health", app.HealthHandler).Methods("GET")
 	r.HandleFunc("/register", app.RegisterHandler).Methods("POST")
 	r.HandleFunc("/login", app.LoginHandler).Methods("POST")
-
-	// 初始化缓存中间件
-	uuidCacheMiddleware := middleware.NewUUIDCacheMiddleware(db, redisClient)
+	r.HandleFunc("/widget/styles", app.WidgetStylesHandler).Methods("GET")
+	r.HandleFunc("/replay/{id}/control", app.ReplayControlHandler).Methods("POST")
 
 	// 应用到需要UUID转换的路由
 	uuidRouter := r.PathPrefix("/uuid").Subrouter()
 	uuidRouter.Use(uuidCacheMiddleware.Handler)
 	uuidRouter.HandleFunc("/{uuid}/receive_data", app.UUIDReportDataHandler).Methods("POST")
 	uuidRouter.HandleFunc("/{uuid}/latest-heart-rate", app.PublicHeartRateHandler).Methods("GET")
+	uuidRouter.HandleFunc("/{uuid}/stream", app.PublicHeartRateStreamHandler).Methods("GET")
+	uuidRouter.HandleFunc("/{uuid}/badge.svg", app.PublicHeartRateBadgeHandler).Methods("GET")
+	uuidRouter.HandleFunc("/{uuid}/image.png", app.PublicHeartRateImageHandler).Methods("GET")
+	uuidRouter.HandleFunc("/{uuid}/history", app.PublicHeartRateHistoryHandler).Methods("GET")
+	uuidRouter.HandleFunc("/{uuid}/hrv", app.PublicHRVHandler).Methods("GET")
+	uuidRouter.HandleFunc("/{uuid}/replay", app.PublicReplaySamplesHandler).Methods("GET")
+	uuidRouter.HandleFunc("/{uuid}/replay/{id}", app.PublicReplayStateHandler).Methods("GET")
 	uuidRouter.HandleFunc("/widget/view/{uuid}", app.PublicHeartRateHTMLHandler).Methods("GET")
+	uuidRouter.HandleFunc("/widget/{style}/{uuid}", app.PublicHeartRateHTMLHandler).Methods("GET")
+
+	// 分享链接，令牌映射到用户后复用UUID的公开处理器，只有打开组件页面计入查看次数。
+	// 限制次数的链接，数据接口需要打开页面时签发的查看会话 /s/{token}/v/{view}/...
+	shareRouter := r.PathPrefix("/s/{token}").Subrouter()
+	shareRouter.Use(shareLinkMiddleware.Handler)
+	shareRouter.Handle("", shareLinkMiddleware.CountView(http.HandlerFunc(app.PublicHeartRateHTMLHandler))).Methods("GET")
+	shareRouter.Handle("/widget/{style}", shareLinkMiddleware.CountView(http.HandlerFunc(app.PublicHeartRateHTMLHandler))).Methods("GET")
+	shareViewRouter := shareRouter.PathPrefix("/v/{view}").Subrouter()
+	for _, router := range []*mux.Router{shareRouter, shareViewRouter} {
+		data := router.NewRoute().Subrouter()
+		data.Use(shareLinkMiddleware.RequireView)
+		data.HandleFunc("/latest-heart-rate", app.PublicHeartRateHandler).Methods("GET")
+		data.HandleFunc("/stream", app.PublicHeartRateStreamHandler).Methods("GET")
+		data.HandleFunc("/history", app.PublicHeartRateHistoryHandler).Methods("GET")
+		data.HandleFunc("/hrv", app.PublicHRVHandler).Methods("GET")
+		data.HandleFunc("/badge.svg", app.PublicHeartRateBadgeHandler).Methods("GET")
+		data.HandleFunc("/image.png", app.PublicHeartRateImageHandler).Methods("GET")
+		data.HandleFunc("/replay", app.PublicReplaySamplesHandler).Methods("GET")
+		data.HandleFunc("/replay/{id}", app.PublicReplayStateHandler).Methods("GET")
+	}
+
+	// 设备上报，使用设备令牌认证
+	deviceRouter := r.PathPrefix("/device").Subrouter()
+	deviceRouter.Use(deviceAuthMiddleware.Handler)
+	deviceRouter.HandleFunc("/receive_data", app.DeviceReportDataHandler).Methods("POST")
+
+	// 签名链接路由，签名校验通过后才会进入处理器
+	signedRouter := r.PathPrefix("/w/{signed}").Subrouter()
+	signedRouter.Use(signedWidgetMiddleware.Handler)
+	signedRouter.HandleFunc("", app.PublicHeartRateHTMLHandler).Methods("GET")
+	signedRouter.HandleFunc("/latest-heart-rate", app.PublicHeartRateHandler).Methods("GET")
+	signedRouter.HandleFunc("/stream", app.PublicHeartRateStreamHandler).Methods("GET")
+	signedRouter.HandleFunc("/history", app.PublicHeartRateHistoryHandler).Methods("GET")
+	signedRouter.HandleFunc("/hrv", app.PublicHRVHandler).Methods("GET")
+	signedRouter.HandleFunc("/badge.svg", app.PublicHeartRateBadgeHandler).Methods("GET")
+	signedRouter.HandleFunc("/image.png", app.PublicHeartRateImageHandler).Methods("GET")
+	signedRouter.HandleFunc("/replay", app.PublicReplaySamplesHandler).Methods("GET")
+	signedRouter.HandleFunc("/replay/{id}", app.PublicReplayStateHandler).Methods("GET")
 
 	// Authenticated routes
 	authRouter := r.PathPrefix("").Subrouter()
 	authRouter.Use(middleware.AuthMiddleware(secureCookie, app.Config))
 	authRouter.HandleFunc("/receive_data", app.ReceiveDataHandler).Methods("POST")
 	authRouter.HandleFunc("/latest-heart-rate", app.LatestHeartRateHandler).Methods("GET")
+	authRouter.HandleFunc("/history", app.HeartRateHistoryHandler).Methods("GET")
+	authRouter.HandleFunc("/hrv", app.HRVHandler).Methods("GET")
 	authRouter.HandleFunc("/uuid", app.GetUUIDHandler).Methods("GET")
 	authRouter.HandleFunc("/logout", app.LogoutHandler).Methods("POST")
+	authRouter.HandleFunc("/account/uuid", app.RegenerateUUIDHandler).Methods("POST")
+	authRouter.HandleFunc("/account", app.DeleteAccountHandler).Methods("DELETE")
+	authRouter.HandleFunc("/account/widget-secret", app.RotateWidgetSecretHandler).Methods("POST")
+	authRouter.HandleFunc("/account/privacy", app.GetPrivacyHandler).Methods("GET")
+	authRouter.HandleFunc("/account/privacy", app.SavePrivacyHandler).Methods("PUT")
+	authRouter.HandleFunc("/account/profile", app.GetProfileHandler).Methods("GET")
+	authRouter.HandleFunc("/account/profile", app.SaveProfileHandler).Methods("PUT")
+	authRouter.HandleFunc("/devices", app.ListDevicesHandler).Methods("GET")
+	authRouter.HandleFunc("/devices", app.CreateDeviceHandler).Methods("POST")
+	authRouter.HandleFunc("/devices/{id}", app.UpdateDeviceHandler).Methods("PUT")
+	authRouter.HandleFunc("/devices/{id}", app.DeleteDeviceHandler).Methods("DELETE")
+	authRouter.HandleFunc("/alerts/rules", app.ListAlertRulesHandler).Methods("GET")
+	authRouter.HandleFunc("/alerts/rules", app.CreateAlertRuleHandler).Methods("POST")
+	authRouter.HandleFunc("/alerts/rules/{id}", app.UpdateAlertRuleHandler).Methods("PUT")
+	authRouter.HandleFunc("/alerts/rules/{id}", app.DeleteAlertRuleHandler).Methods("DELETE")
+	authRouter.HandleFunc("/alerts/history", app.AlertHistoryHandler).Methods("GET")
+	authRouter.HandleFunc("/webhooks", app.ListWebhooksHandler).Methods("GET")
+	authRouter.HandleFunc("/webhooks", app.CreateWebhookHandler).Methods("POST")
+	authRouter.HandleFunc("/webhooks/{id}", app.UpdateWebhookHandler).Methods("PUT")
+	authRouter.HandleFunc("/webhooks/{id}", app.DeleteWebhookHandler).Methods("DELETE")
+	authRouter.HandleFunc("/webhooks/{id}/secret", app.RotateWebhookSecretHandler).Methods("POST")
+	authRouter.HandleFunc("/webhooks/{id}/ping", app.PingWebhookHandler).Methods("POST")
+	authRouter.HandleFunc("/webhooks/{id}/deliveries", app.WebhookDeliveriesHandler).Methods("GET")
+	authRouter.HandleFunc("/widget/sign", app.SignWidgetHandler).Methods("POST")
+	authRouter.HandleFunc("/widget/presets", app.ListWidgetPresetsHandler).Methods("GET")
+	authRouter.HandleFunc("/widget/presets/{name}", app.SaveWidgetPresetHandler).Methods("PUT")
+	authRouter.HandleFunc("/widget/presets/{name}", app.DeleteWidgetPresetHandler).Methods("DELETE")
+	authRouter.HandleFunc("/widget/custom", app.GetCustomWidgetHandler).Methods("GET")
+	authRouter.HandleFunc("/widget/custom", app.SaveCustomWidgetHandler).Methods("PUT")
+	authRouter.HandleFunc("/widget/custom", app.DeleteCustomWidgetHandler).Methods("DELETE")
+	authRouter.HandleFunc("/replay", app.CreateReplayHandler).Methods("POST")
+	authRouter.HandleFunc("/share-links", app.ListShareLinksHandler).Methods("GET")
+	authRouter.HandleFunc("/share-links", app.CreateShareLinkHandler).Methods("POST")
+	authRouter.HandleFunc("/share-links/{id}", app.RevokeShareLinkHandler).Methods("DELETE")
+	authRouter.HandleFunc("/widget/custom/preview", app.PreviewCustomWidgetHandler).Methods("POST")
 
 	// Create server
 	server := &http.Server{
@@ -96,6 +242,8 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// 停机时断开实时推送的长连接，否则 Shutdown 会一直等待
+	server.RegisterOnShutdown(liveHub.Close)
 
 	// Start server in a goroutine
 	go func() {
@@ -110,6 +258,8 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	stopBackground()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
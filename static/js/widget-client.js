@@ -0,0 +1,191 @@
+// 心率组件共享的数据客户端：优先使用 Server-Sent Events，不支持时退回轮询。
+// 每次更新都会把 live / stale / offline 状态和心率区间（zone-0 至 zone-5）同步到 body 的 class 上。
+(function (global) {
+    'use strict';
+
+    function setStatus(status) {
+        document.body.classList.remove('live', 'stale', 'offline');
+        document.body.classList.add(status);
+    }
+
+    // zoneColors 依次为静息及第1至5区间的颜色
+    const zoneColors = ['#90a4ae', '#4fc3f7', '#66bb6a', '#ffca28', '#ff7043', '#f20044'];
+
+    // setZone 更新区间 class；body 带有 zone-colors 时用区间颜色覆盖 --heart-color。
+    // 离线时保留上一次的区间
+    function setZone(data) {
+        if (!data || data.zone_index === undefined) {
+            return;
+        }
+        const body = document.body;
+        zoneColors.forEach((_, i) => body.classList.remove(`zone-${i}`));
+        body.classList.add(`zone-${data.zone_index}`);
+        if (body.classList.contains('zone-colors')) {
+            document.documentElement.style.setProperty('--heart-color', zoneColors[data.zone_index]);
+        }
+    }
+
+    // 隐私设置为区间模式时只有区间名称，没有心率数值
+    function dispatch(onUpdate, data) {
+        const live = data && (data.heart_rate || data.zone_name) ? data : null;
+        const status = live ? (live.status || 'live') : 'offline';
+        setStatus(status);
+        setZone(live);
+        onUpdate(live, status);
+    }
+
+    // query 生成附加的查询参数，delay 为数据相对实时的延迟秒数
+    function query(delay, prefix) {
+        return delay > 0 ? `${prefix}delay=${delay}` : '';
+    }
+
+    function stream(options) {
+        const source = new EventSource(`${options.base}/stream${query(options.delay, '?')}`);
+        source.addEventListener('heart_rate', event => dispatch(options.onUpdate, JSON.parse(event.data)));
+        source.onerror = () => {
+            dispatch(options.onUpdate, null);
+            // 非200响应时浏览器不会自动重连，稍后重新建立连接
+            if (source.readyState === EventSource.CLOSED) {
+                setTimeout(() => stream(options), 5000);
+            }
+        };
+    }
+
+    async function poll(options) {
+        while (true) {
+            let data = null;
+            try {
+                const response = await fetch(`${options.base}/latest-heart-rate${query(options.delay, '?')}`);
+                const body = await response.json();
+                if (response.ok) {
+                    data = body.data;
+                } else {
+                    console.warn('No heart rate data:', body);
+                }
+            } catch (err) {
+                console.error(err);
+            }
+            dispatch(options.onUpdate, data);
+            // 离线时降低轮询频率，但保持重试
+            const delay = data && data.status !== 'offline' ? 1000 : 5000;
+            await new Promise(resolve => setTimeout(resolve, delay));
+        }
+    }
+
+    // replay 按录制时间播放 [from, to] 内的样本。指定 session 时每秒同步服务端的播放状态，
+    // 否则页面加载后自动从头播放
+    async function replay(options) {
+        const r = options.replay;
+        let samples = [];
+        try {
+            const response = await fetch(`${options.base}/replay?from=${r.from}&to=${r.to}`);
+            const body = await response.json();
+            if (response.ok) {
+                samples = body.data.samples;
+            }
+        } catch (err) {
+            console.error(err);
+        }
+
+        // state 为最近一次同步的状态，anchor 为同步时的本地时间
+        let state = {playing: true, position: r.from, speed: r.speed, to: r.to};
+        let anchor = Date.now();
+        clock.now = () => {
+            if (!state.playing) {
+                return state.position;
+            }
+            return Math.min(state.to, state.position + (Date.now() - anchor) * state.speed);
+        };
+
+        if (r.session) {
+            const sync = async () => {
+                try {
+                    const response = await fetch(`${options.base}/replay/${encodeURIComponent(r.session)}`);
+                    const body = await response.json();
+                    if (response.ok) {
+                        state = body.data;
+                        anchor = Date.now();
+                    }
+                } catch (err) {
+                    console.error(err);
+                }
+            };
+            await sync();
+            setInterval(sync, 1000);
+        }
+
+        let shown = null;
+        setInterval(() => {
+            const now = clock.now();
+            // 最后一条不晚于当前进度的样本
+            let lo = 0, hi = samples.length;
+            while (lo < hi) {
+                const mid = (lo + hi) >> 1;
+                if (samples[mid].measured_at <= now) {
+                    lo = mid + 1;
+                } else {
+                    hi = mid;
+                }
+            }
+            const sample = lo > 0 ? samples[lo - 1] : null;
+            let data = null;
+            if (sample) {
+                const age = now - sample.measured_at;
+                const status = age >= r.offline_after_ms ? 'offline' : (age >= r.stale_after_ms ? 'stale' : 'live');
+                data = {heart_rate: sample.heart_rate, measured_at: sample.measured_at, age_ms: Math.round(age), status};
+            }
+            const key = data ? `${data.measured_at}:${data.status}` : 'none';
+            if (key !== shown) {
+                shown = key;
+                dispatch(options.onUpdate, data && data.status !== 'offline' ? data : null);
+            }
+        }, 200);
+    }
+
+    // clock 当前显示的数据时间，回放时为录制时间轴上的位置
+    const clock = {now: () => Date.now()};
+
+    // connect 开始接收数据，options.base 为数据接口前缀（如 /uuid/{uuid}），
+    // options.delay 为可选的延迟秒数，options.replay 为可选的回放参数，
+    // options.onUpdate(data, status) 在每次更新时调用，离线时 data 为 null。
+    // 返回的对象提供 now()，供趋势图等按数据时间绘制
+    function connect(options) {
+        const delayMs = (options.delay || 0) * 1000;
+        clock.now = () => Date.now() - delayMs;
+
+        const start = () => {
+            if (options.replay) {
+                replay(options);
+            } else if (global.EventSource) {
+                stream(options);
+            } else {
+                poll(options);
+            }
+        };
+        if (document.readyState === 'loading') {
+            document.addEventListener('DOMContentLoaded', start);
+        } else {
+            start();
+        }
+        return {now: () => clock.now()};
+    }
+
+    // history 获取最近 minutes 分钟的样本，用于页面加载时填充趋势图
+    async function history(base, minutes, delay) {
+        try {
+            const response = await fetch(`${base}/history?minutes=${minutes}${query(delay, '&')}`);
+            const body = await response.json();
+            return response.ok ? body.data.samples : [];
+        } catch (err) {
+            console.error(err);
+            return [];
+        }
+    }
+
+    // display 返回要显示的文本：心率数值，区间模式下为区间名称
+    function display(data) {
+        return data.heart_rate || data.zone_name;
+    }
+
+    global.HeartRateWidget = {connect, history, display};
+})(window);
@@ -0,0 +1,31 @@
+// 自定义组件脚本：在严格的CSP下只能以外部脚本方式加载，
+// 数据接口前缀、延迟和回放参数从 body 的 data-base、data-delay、data-replay 属性读取，并填充 data-field 占位元素
+(function () {
+    'use strict';
+
+    function fill(field, value) {
+        document.querySelectorAll(`[data-field="${field}"]`).forEach(el => {
+            el.textContent = value;
+        });
+    }
+
+    document.addEventListener('DOMContentLoaded', () => {
+        HeartRateWidget.connect({
+            base: document.body.dataset.base,
+            delay: Number(document.body.dataset.delay) || 0,
+            replay: document.body.dataset.replay ? JSON.parse(document.body.dataset.replay) : null,
+            onUpdate: (data, status) => {
+                fill('status', status);
+                if (!data) {
+                    return;
+                }
+                document.documentElement.style.setProperty('--heart-speed', (60 / data.heart_rate) + 's');
+                document.documentElement.style.setProperty('--bpm', data.heart_rate);
+                fill('bpm', HeartRateWidget.display(data));
+                document.documentElement.style.setProperty('--zone', data.zone_index);
+                fill('zone', data.zone_name || '');
+                fill('age', Math.round(data.age_ms / 1000));
+            },
+        });
+    });
+})();